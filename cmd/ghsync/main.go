@@ -19,6 +19,12 @@ var app = cli.New("ghsync", version, build, "GitHub metadata sync")
 func main() {
 	app.AddCommand(&subcmd.ShallowCommand{})
 	app.AddCommand(&subcmd.DeepCommand{})
+	app.AddCommand(&subcmd.EnqueueCommand{})
+	app.AddCommand(&subcmd.RepoCommand{})
+	app.AddCommand(&subcmd.ItemCommand{})
+	app.AddCommand(&subcmd.SyncCommand{})
+	app.AddCommand(&subcmd.DaemonCommand{})
+	app.AddCommand(&subcmd.StatusCommand{})
 	app.AddCommand(&subcmd.MigrateCommand{})
 
 	app.RunMain()
@@ -7,10 +7,17 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/src-d/ghsync/deep"
 	"github.com/src-d/ghsync/models/migrations"
+	"github.com/src-d/ghsync/shallow"
 	"github.com/src-d/ghsync/utils"
 	"gopkg.in/src-d/go-log.v1"
+	"gopkg.in/src-d/go-queue.v1"
+	_ "gopkg.in/src-d/go-queue.v1/amqp"
+	_ "gopkg.in/src-d/go-queue.v1/memory"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -18,18 +25,24 @@ import (
 	"github.com/google/go-github/github"
 	"github.com/gregjones/httpcache"
 	"github.com/gregjones/httpcache/diskcache"
-	"golang.org/x/oauth2"
 )
 
 const maxVersion uint = 1560510971
 const statusTableName = "status"
+const progressTableName = "deep_status"
+const dedupTableName = "deep_dedup"
+const cursorTableName = "shallow_cursors"
+const failureTableName = "shallow_failures"
+
+// defaultBaseURL is the base URL of the github.com API used by go-github.
+const defaultBaseURL = "https://api.github.com/"
 
 type PostgresOpt struct {
-	DB       string `long:"postgres-db" env:"GHSYNC_POSTGRES_DB" description:"PostgreSQL DB" default:"ghsync"`
-	User     string `long:"postgres-user" env:"GHSYNC_POSTGRES_USER" description:"PostgreSQL user" default:"superset"`
-	Password string `long:"postgres-password" env:"GHSYNC_POSTGRES_PASSWORD" description:"PostgreSQL password" default:"superset"`
-	Host     string `long:"postgres-host" env:"GHSYNC_POSTGRES_HOST" description:"PostgreSQL host" default:"localhost"`
-	Port     int    `long:"postgres-port" env:"GHSYNC_POSTGRES_PORT" description:"PostgreSQL port" default:"5432"`
+	DB       string `long:"postgres-db" env:"GHSYNC_POSTGRES_DB" description:"PostgreSQL DB" default:"ghsync" yaml:"db" toml:"db"`
+	User     string `long:"postgres-user" env:"GHSYNC_POSTGRES_USER" description:"PostgreSQL user" default:"superset" yaml:"user" toml:"user"`
+	Password string `long:"postgres-password" env:"GHSYNC_POSTGRES_PASSWORD" description:"PostgreSQL password" default:"superset" yaml:"password" toml:"password"`
+	Host     string `long:"postgres-host" env:"GHSYNC_POSTGRES_HOST" description:"PostgreSQL host" default:"localhost" yaml:"host" toml:"host"`
+	Port     int    `long:"postgres-port" env:"GHSYNC_POSTGRES_PORT" description:"PostgreSQL port" default:"5432" yaml:"port" toml:"port"`
 }
 
 func (o PostgresOpt) URL() string {
@@ -37,8 +50,24 @@ func (o PostgresOpt) URL() string {
 		o.User, o.Password, o.Host, o.Port, o.DB)
 }
 
+// openDB connects to the DB, without checking its version nor creating the
+// tables, for the commands that only read from it.
+func (o PostgresOpt) openDB() (*sql.DB, error) {
+	db, err := sql.Open("postgres", o.URL())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
 func (o PostgresOpt) initDB() (db *sql.DB, err error) {
-	db, err = sql.Open("postgres", o.URL())
+	db, err = o.openDB()
 	if err != nil {
 		return nil, err
 	}
@@ -50,10 +79,6 @@ func (o PostgresOpt) initDB() (db *sql.DB, err error) {
 		}
 	}()
 
-	if err = db.Ping(); err != nil {
-		return db, err
-	}
-
 	m, err := newMigrate(o.URL())
 	if err != nil {
 		return db, err
@@ -77,6 +102,27 @@ func (o PostgresOpt) initDB() (db *sql.DB, err error) {
 		return db, err
 	}
 
+	if err = createRunsTable(db); err != nil {
+		return db, err
+	}
+
+	if err = deep.CreateProgressTable(db, progressTableName); err != nil {
+		return db, err
+	}
+
+	if err = deep.CreateDedupTable(db, dedupTableName); err != nil {
+		return db, err
+	}
+
+	if err = shallow.CreateCursorTable(db, cursorTableName); err != nil {
+		return db, err
+	}
+
+	if err = shallow.CreateFailureTable(db, failureTableName); err != nil {
+		return db, err
+	}
+
+	health.addReady("postgres", db.PingContext)
 	return db, nil
 }
 
@@ -114,6 +160,105 @@ func (o PostgresOpt) createStatusTable() error {
 	return nil
 }
 
+type QueueOpt struct {
+	Queue    string   `long:"queue" env:"GHSYNC_QUEUE" description:"queue name. If it's not set the organization name will be used" yaml:"queue" toml:"queue"`
+	Broker   string   `long:"broker" env:"GHSYNC_BROKER" default:"amqp://localhost:5672" description:"broker service URI" yaml:"broker" toml:"broker"`
+	Lane     string   `long:"lane" env:"GHSYNC_LANE" choice:"high" choice:"normal" choice:"backfill" description:"Priority lane of the jobs published. The jobs of single repositories and items requested manually go to the high lane by default, the rest to the normal one" yaml:"lane" toml:"lane"`
+	DedupTTL []string `long:"dedup-ttl" env:"GHSYNC_DEDUP_TTL" env-delim:"," default:"1h" description:"Jobs already pending or handled within this period are not published again. A duration applies to every task type, task:duration to a single one, e.g. issue:6h. 0 disables it" yaml:"dedup_ttl" toml:"dedup_ttl"`
+}
+
+// withLane returns a context where the jobs are published to the lane given,
+// or to defaultLane if no lane was given.
+func (o QueueOpt) withLane(ctx context.Context, defaultLane deep.Lane) (context.Context, error) {
+	if o.Lane == "" {
+		return deep.WithLane(ctx, defaultLane), nil
+	}
+
+	l, err := deep.ParseLane(o.Lane)
+	if err != nil {
+		return nil, err
+	}
+
+	return deep.WithLane(ctx, l), nil
+}
+
+// dedup returns the Dedup of the deep jobs published with the TTLs given.
+func (o QueueOpt) dedup(db *sql.DB) (*deep.Dedup, error) {
+	d := deep.NewDedup(db, dedupTableName, 0)
+	if err := d.ParseTTL(o.DedupTTL); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// openQueue connects to the broker and opens the queue, defaultName is used
+// if no queue name was given.
+func (o QueueOpt) openQueue(defaultName string) (queue.Queue, error) {
+	broker, err := queue.NewBroker(o.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	name := o.Queue
+	if name == "" {
+		name = defaultName
+	}
+
+	queueDepth.watch(o.Broker, name)
+	health.addQueue(o.Broker, name)
+	return broker.Queue(name)
+}
+
+type RepositoryFilterOpt struct {
+	Include      []string      `long:"include" env:"GHSYNC_INCLUDE" env-delim:"," description:"Only the repositories matching any of these names will be synced. Glob patterns and regular expressions between slashes are accepted, e.g. go-* or /^go-.*$/" yaml:"include" toml:"include"`
+	Exclude      []string      `long:"exclude" env:"GHSYNC_EXCLUDE" env-delim:"," description:"Repositories matching any of these names will be skipped. Glob patterns and regular expressions between slashes are accepted" yaml:"exclude" toml:"exclude"`
+	NoForks      bool          `long:"no-forks" env:"GHSYNC_NO_FORKS" description:"github forked repositories will be skipped" yaml:"no_forks" toml:"no_forks"`
+	NoArchived   bool          `long:"no-archived" env:"GHSYNC_NO_ARCHIVED" description:"github archived repositories will be skipped" yaml:"no_archived" toml:"no_archived"`
+	Visibility   string        `long:"visibility" env:"GHSYNC_VISIBILITY" choice:"all" choice:"public" choice:"private" default:"all" description:"visibility of the repositories to sync" yaml:"visibility" toml:"visibility"`
+	Topics       []string      `long:"topic" env:"GHSYNC_TOPICS" env-delim:"," description:"Only the repositories with any of these topics will be synced" yaml:"topics" toml:"topics"`
+	Languages    []string      `long:"language" env:"GHSYNC_LANGUAGES" env-delim:"," description:"Only the repositories with any of these main languages will be synced" yaml:"languages" toml:"languages"`
+	PushedWithin time.Duration `long:"pushed-within" env:"GHSYNC_PUSHED_WITHIN" description:"Only the repositories pushed within this period will be synced, e.g. 8760h" yaml:"pushed_within" toml:"pushed_within"`
+}
+
+func (o RepositoryFilterOpt) filter() (*utils.RepositoryFilter, error) {
+	return o.options().Filter()
+}
+
+// options returns the filter as the options of a deep job.
+func (o RepositoryFilterOpt) options() *deep.RepositoryFilterOptions {
+	return &deep.RepositoryFilterOptions{
+		Include:      o.Include,
+		Exclude:      o.Exclude,
+		NoForks:      o.NoForks,
+		NoArchived:   o.NoArchived,
+		Visibility:   o.Visibility,
+		Topics:       o.Topics,
+		Languages:    o.Languages,
+		PushedWithin: o.PushedWithin,
+	}
+}
+
+type ReportOpt struct {
+	Report string `long:"report" env:"GHSYNC_REPORT" choice:"text" choice:"json" choice:"none" default:"text" description:"Format of the summary of the run printed at exit"`
+}
+
+// print writes the summary of the runs to the standard output.
+func (o ReportOpt) print(runs ...*run) {
+	if o.Report == "none" {
+		return
+	}
+
+	if err := writeReports(os.Stdout, o.Report, runs); err != nil {
+		log.Errorf(err, "unable to write the report")
+	}
+}
+
+type GitHubOpt struct {
+	URL       string `long:"github-url" env:"GHSYNC_GITHUB_URL" description:"GitHub Enterprise Server base URL, e.g. https://github.example.com/. If it's not set github.com will be used" yaml:"url" toml:"url"`
+	UploadURL string `long:"github-upload-url" env:"GHSYNC_GITHUB_UPLOAD_URL" description:"GitHub Enterprise Server upload URL. If it's not set it's derived from the base URL" yaml:"upload_url" toml:"upload_url"`
+}
+
 func newMigrate(url string) (*migrate.Migrate, error) {
 	// wrap assets into Resource
 	s := bindata.Resource(migrations.AssetNames(),
@@ -128,10 +273,31 @@ func newMigrate(url string) (*migrate.Migrate, error) {
 	return migrate.NewWithSourceInstance("go-bindata", d, url)
 }
 
-func newClient(token string) (*github.Client, error) {
-	http := oauth2.NewClient(context.TODO(), oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	))
+// newClient returns a GitHub client using the given comma-separated tokens.
+// The API calls made are counted in stats, that can be nil.
+func (o GitHubOpt) newClient(token string, stats *utils.Stats) (*github.Client, error) {
+	var tokens []string
+	for _, t := range strings.Split(token, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tokens = append(tokens, t)
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("at least one GitHub token must be provided")
+	}
+
+	// the requests are labelled in the metrics and spans by their path
+	// relative to the API base URL
+	baseURL := defaultBaseURL
+	if o.URL != "" {
+		baseURL = enterpriseURL(o.URL, "api/v3/")
+	}
+
+	http := &http.Client{
+		Transport: utils.NewStatsTransport(
+			utils.NewTokenPoolTransport(utils.NewMetricsTransport(http.DefaultTransport, baseURL), tokens), stats),
+	}
 
 	dirPath := filepath.Join(os.TempDir(), "ghsync")
 	err := os.MkdirAll(dirPath, os.ModePerm)
@@ -141,9 +307,38 @@ func newClient(token string) (*github.Client, error) {
 
 	t := httpcache.NewTransport(diskcache.New(dirPath))
 	t.Transport = &RemoveHeaderTransport{utils.NewRateLimitTransport(http.Transport)}
-	http.Transport = &RetryTransport{T: t}
+	http.Transport = utils.NewTracingTransport(&RetryTransport{T: utils.NewCacheMetricsTransport(t)}, baseURL)
+
+	if o.URL == "" {
+		return github.NewClient(http), nil
+	}
+
+	uploadURL := enterpriseURL(o.URL, "api/uploads/")
+	if o.UploadURL != "" {
+		uploadURL = enterpriseURL(o.UploadURL, "api/uploads/")
+	}
+
+	return github.NewEnterpriseClient(baseURL, uploadURL, http)
+}
 
-	return github.NewClient(http), nil
+// urlParser returns the parser of the issue and pull request URLs of
+// github.com and, if it's set, of the GitHub Enterprise Server instance.
+func (o GitHubOpt) urlParser() (*utils.URLParser, error) {
+	return utils.NewURLParser(o.URL)
+}
+
+// enterpriseURL appends the API path to a GitHub Enterprise Server URL,
+// unless it's already part of it.
+func enterpriseURL(rawurl, path string) string {
+	if !strings.HasSuffix(rawurl, "/") {
+		rawurl += "/"
+	}
+
+	if strings.HasSuffix(rawurl, path) {
+		return rawurl
+	}
+
+	return rawurl + path
 }
 
 type RemoveHeaderTransport struct {
@@ -164,7 +359,16 @@ type RetryTransport struct {
 func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	var r *http.Response
 	var err error
-	utils.Retry(func() error {
+	var attempts int
+	utils.Retry(req.Context(), func() error {
+		if attempts > 0 {
+			if err = utils.RewindBody(req); err != nil {
+				// the request can't be sent again, stop retrying
+				return nil
+			}
+		}
+
+		attempts++
 		r, err = t.T.RoundTrip(req)
 		return err
 	})
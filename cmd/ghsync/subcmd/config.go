@@ -0,0 +1,263 @@
+package subcmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/src-d/ghsync/shallow"
+	"github.com/src-d/ghsync/utils"
+
+	"github.com/BurntSushi/toml"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	shallowMode = "shallow"
+	deepMode    = "deep"
+)
+
+// Config is the declarative definition of the sync targets, loaded from a
+// YAML or TOML file. The values not set in the file keep the ones given
+// using flags or environment variables.
+type Config struct {
+	// Tokens are the GitHub tokens used by the targets without their own
+	Tokens   []string    `yaml:"tokens" toml:"tokens"`
+	GitHub   GitHubOpt   `yaml:"github" toml:"github"`
+	Postgres PostgresOpt `yaml:"postgres" toml:"postgres"`
+	Queue    QueueOpt    `yaml:"queue" toml:"queue"`
+	Targets  []*Target   `yaml:"targets" toml:"targets"`
+}
+
+// Target is a set of organizations, users and repositories synced together.
+type Target struct {
+	Name string `yaml:"name" toml:"name"`
+	// Mode is shallow or deep. Deep targets only publish the jobs, that are
+	// handled by the deep workers
+	Mode string `yaml:"mode" toml:"mode"`
+	// Schedule is a cron expression, or a descriptor like @every 15m, for
+	// the runs of the target in daemon mode
+	Schedule string `yaml:"schedule" toml:"schedule"`
+
+	Orgs  []string `yaml:"orgs" toml:"orgs"`
+	Users []string `yaml:"users" toml:"users"`
+	// Repos are single repositories, as owner/name
+	Repos []string `yaml:"repos" toml:"repos"`
+
+	// Entities are the entities synced, all of them if it's empty. Deep
+	// targets publish them in their jobs, so the workers sync these instead
+	// of the ones given with their own --entities
+	Entities []string `yaml:"entities" toml:"entities"`
+	// Tokens are only used by shallow targets, the jobs of the deep ones are
+	// handled by the workers with their own
+	Tokens []string `yaml:"tokens" toml:"tokens"`
+	// Filter selects the repositories of the organizations and users, deep
+	// targets publish it in their jobs like the entities
+	Filter RepositoryFilterOpt `yaml:"filter" toml:"filter"`
+	// OnError is abort or continue, what shallow targets do when an
+	// organization, repository or user fails to sync
+	OnError string `yaml:"on_error" toml:"on_error"`
+	// Parallelism is the number of organizations, and of repositories of
+	// each one, that shallow targets sync in parallel, 1 if it's not set
+	Parallelism int `yaml:"parallelism" toml:"parallelism"`
+}
+
+// owners returns the organizations and users of the target.
+func (t *Target) owners() []string {
+	return append(append([]string{}, t.Orgs...), t.Users...)
+}
+
+// lockedOwners returns the organizations and users locked while the target
+// is synced, including the owners of its repositories.
+func (t *Target) lockedOwners() []string {
+	owners := t.owners()
+	for _, r := range t.Repos {
+		if owner, _, err := splitRepositoryName(r); err == nil {
+			owners = append(owners, owner)
+		}
+	}
+
+	return owners
+}
+
+// parallelism returns the number of items the target syncs in parallel.
+func (t *Target) parallelism() int {
+	if t.Parallelism < 1 {
+		return 1
+	}
+
+	return t.Parallelism
+}
+
+// targets returns the organizations, users and repositories of the target.
+func (t *Target) targets() []string {
+	return append(t.owners(), t.Repos...)
+}
+
+// token returns the tokens of the target, as expected by newClient.
+func (t *Target) token(cfg *Config) string {
+	if len(t.Tokens) != 0 {
+		return strings.Join(t.Tokens, ",")
+	}
+
+	return strings.Join(cfg.Tokens, ",")
+}
+
+// envVarRegexp matches the ${VAR} references to environment variables. The
+// $VAR form is not supported, to not clash with the regular expressions.
+var envVarRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// loadConfig reads the config file at path into cfg. The format is guessed
+// from the file extension, YAML is used if it's not .toml.
+func loadConfig(path string, cfg *Config) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	isTOML := strings.ToLower(filepath.Ext(path)) == ".toml"
+
+	// the ${VAR} references are expanded in the decoded values, not in the
+	// file, so a value with quotes or line breaks can't change its syntax.
+	// Then they are encoded again, properly quoted, and decoded into cfg
+	var values interface{}
+	if isTOML {
+		var table map[string]interface{}
+		_, err = toml.Decode(string(content), &table)
+		values = table
+	} else {
+		err = yaml.Unmarshal(content, &values)
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot parse %s: %v", path, err)
+	}
+
+	var missing []string
+	values = expandEnvVars(values, &missing)
+	if len(missing) != 0 {
+		return fmt.Errorf("undefined environment variables in %s: %s",
+			path, strings.Join(missing, ", "))
+	}
+
+	if isTOML {
+		var buf bytes.Buffer
+		if err = toml.NewEncoder(&buf).Encode(values); err == nil {
+			_, err = toml.Decode(buf.String(), cfg)
+		}
+	} else if content, err = yaml.Marshal(values); err == nil {
+		err = yaml.UnmarshalStrict(content, cfg)
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot parse %s: %v", path, err)
+	}
+
+	return cfg.validate()
+}
+
+// expandEnvVars returns the decoded value v with the ${VAR} references of its
+// strings replaced, the names of the variables not defined are appended to
+// missing. Only the string values are expanded, not the keys.
+func expandEnvVars(v interface{}, missing *[]string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return envVarRegexp.ReplaceAllStringFunc(v, func(ref string) string {
+			name := envVarRegexp.FindStringSubmatch(ref)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				*missing = append(*missing, name)
+			}
+
+			return value
+		})
+	case []interface{}:
+		for i := range v {
+			v[i] = expandEnvVars(v[i], missing)
+		}
+	case []map[string]interface{}:
+		for _, m := range v {
+			expandEnvVars(m, missing)
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = expandEnvVars(v[k], missing)
+		}
+	case map[interface{}]interface{}:
+		for k := range v {
+			v[k] = expandEnvVars(v[k], missing)
+		}
+	}
+
+	return v
+}
+
+func (cfg *Config) validate() error {
+	names := make(map[string]bool)
+	for i, t := range cfg.Targets {
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("target-%d", i+1)
+		}
+
+		if names[t.Name] {
+			return fmt.Errorf("duplicated target name %q", t.Name)
+		}
+		names[t.Name] = true
+
+		switch t.Mode {
+		case "":
+			t.Mode = shallowMode
+		case shallowMode, deepMode:
+		default:
+			return fmt.Errorf("target %q: unknown mode %q", t.Name, t.Mode)
+		}
+
+		onError, err := shallow.ParseOnError(t.OnError)
+		if err != nil {
+			return fmt.Errorf("target %q: %v", t.Name, err)
+		}
+		t.OnError = string(onError)
+
+		if len(t.Orgs)+len(t.Users)+len(t.Repos) == 0 {
+			return fmt.Errorf("target %q: at least one organization, user or repository must be provided", t.Name)
+		}
+
+		if t.Schedule != "" {
+			if _, err := cron.ParseStandard(t.Schedule); err != nil {
+				return fmt.Errorf("target %q: invalid schedule: %v", t.Name, err)
+			}
+		}
+
+		if _, err := utils.ParseEntities(t.Entities); err != nil {
+			return fmt.Errorf("target %q: %v", t.Name, err)
+		}
+
+		for _, r := range t.Repos {
+			if _, _, err := splitRepositoryName(r); err != nil {
+				return fmt.Errorf("target %q: %v", t.Name, err)
+			}
+		}
+
+		if t.Mode == shallowMode && t.token(cfg) == "" {
+			return fmt.Errorf("target %q: no GitHub token provided", t.Name)
+		}
+	}
+
+	return nil
+}
+
+// target returns the target with the given name.
+func (cfg *Config) target(name string) (*Target, error) {
+	for _, t := range cfg.Targets {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("target %q not found", name)
+}
@@ -0,0 +1,109 @@
+package subcmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/robfig/cron/v3"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+type DaemonCommand struct {
+	cli.Command `name:"daemon" short-description:"Run the sync targets on a schedule" long-description:"Keeps running and syncs the targets defined in a YAML or TOML config file on their cron schedule. A run is skipped if the previous run of the same target is still in progress, even in another process"`
+
+	Config  string   `long:"config" env:"GHSYNC_CONFIG" description:"YAML or TOML config file" required:"true"`
+	Targets []string `long:"target" description:"Name of a target to schedule. All the targets with a schedule are used if it's not given"`
+
+	QueueOpt QueueOpt    `group:"go-queue connection options"`
+	Metrics  MetricsOpt  `group:"Metrics options"`
+	Tracing  TracingOpt  `group:"Tracing options"`
+	GitHub   GitHubOpt   `group:"GitHub Enterprise options"`
+	Postgres PostgresOpt `group:"PostgreSQL connection options"`
+}
+
+func (c *DaemonCommand) ExecuteContext(ctx context.Context, args []string) error {
+	cfg := &Config{
+		GitHub:   c.GitHub,
+		Postgres: c.Postgres,
+		Queue:    c.QueueOpt,
+	}
+
+	if err := loadConfig(c.Config, cfg); err != nil {
+		return err
+	}
+
+	targets := cfg.Targets
+	if len(c.Targets) != 0 {
+		targets = nil
+		for _, name := range c.Targets {
+			t, err := cfg.target(name)
+			if err != nil {
+				return err
+			}
+
+			if t.Schedule == "" {
+				return fmt.Errorf("target %q has no schedule", name)
+			}
+
+			targets = append(targets, t)
+		}
+	}
+
+	if err := c.Metrics.serve(); err != nil {
+		return err
+	}
+
+	shutdown, err := c.Tracing.start()
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
+	db, err := cfg.Postgres.initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	scheduler := cron.New()
+	for _, t := range targets {
+		if t.Schedule == "" {
+			log.With(log.Fields{"target": t.Name}).Warningf("target without schedule, ignoring it")
+			continue
+		}
+
+		t := t
+		if _, err := scheduler.AddFunc(t.Schedule, func() {
+			runScheduledTarget(ctx, db, cfg, t)
+		}); err != nil {
+			return fmt.Errorf("target %q: invalid schedule: %v", t.Name, err)
+		}
+
+		log.With(log.Fields{"target": t.Name, "schedule": t.Schedule}).Infof("target scheduled")
+	}
+
+	if len(scheduler.Entries()) == 0 {
+		return fmt.Errorf("no targets with a schedule found in %s", c.Config)
+	}
+
+	scheduler.Start()
+	<-ctx.Done()
+
+	log.Infof("waiting for the running syncs to finish")
+	<-scheduler.Stop().Done()
+
+	return nil
+}
+
+// runScheduledTarget runs a target, unless the daemon is stopping.
+func runScheduledTarget(ctx context.Context, db *sql.DB, cfg *Config, t *Target) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	if _, err := runRecordedTarget(ctx, db, cfg, t); err != nil {
+		log.With(log.Fields{"target": t.Name, "mode": t.Mode}).Errorf(err, "error syncing target")
+	}
+}
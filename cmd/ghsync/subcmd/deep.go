@@ -1,63 +1,136 @@
 package subcmd
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+
 	"github.com/src-d/ghsync/deep"
+	"github.com/src-d/ghsync/utils"
 
 	"gopkg.in/src-d/go-cli.v0"
 	"gopkg.in/src-d/go-log.v1"
-	"gopkg.in/src-d/go-queue.v1"
-	_ "gopkg.in/src-d/go-queue.v1/amqp"
-	_ "gopkg.in/src-d/go-queue.v1/memory"
 )
 
 type DeepCommand struct {
 	cli.Command `name:"deep" short-description:"Deep sync of GitHub data" long-description:"Deep sync of GitHub data"`
 
-	Token string `long:"token" env:"GHSYNC_TOKEN" description:"GitHub personal access token" required:"true"`
-	Org   string `long:"org" env:"GHSYNC_ORG" description:"Name of the GitHub organization" required:"true"`
+	Token string `long:"token" env:"GHSYNC_TOKEN" description:"GitHub personal access token. Several comma-separated tokens can be given to rotate between them" required:"true"`
+	Org   string `long:"org" env:"GHSYNC_ORG" description:"Name of the GitHub organization or user whose queue is consumed, unless --queue is given. Its job is published with the enqueue subcommand"`
+	API   string `long:"api" env:"GHSYNC_API" default:"rest" description:"GitHub API used to retrieve issues and pull requests, rest or graphql. It can be set per entity, e.g. pull-request:graphql,issue:rest"`
+
+	Entities []string `long:"entities" env:"GHSYNC_ENTITIES" env-delim:"," description:"Entities to sync: organizations, repositories, issues, pull_requests, reviews, comments and users. All of them are synced if it's not given"`
 
-	QueueOpt struct {
-		Queue  string `long:"queue" env:"GHSYNC_QUEUE" description:"queue name. If it's not set the organization name will be used"`
-		Broker string `long:"broker" env:"GHSYNC_BROKER" default:"amqp://localhost:5672" description:"broker service URI"`
-	} `group:"go-queue connection options"`
+	QueueOpt QueueOpt            `group:"go-queue connection options"`
+	Filter   RepositoryFilterOpt `group:"Repository filter options"`
+	Report   ReportOpt           `group:"Report options"`
+	Metrics  MetricsOpt          `group:"Metrics options"`
+	Tracing  TracingOpt          `group:"Tracing options"`
 
+	GitHub   GitHubOpt   `group:"GitHub Enterprise options"`
 	Postgres PostgresOpt `group:"PostgreSQL connection options"`
 }
 
-func (c *DeepCommand) Execute(args []string) error {
+func (c *DeepCommand) ExecuteContext(ctx context.Context, args []string) error {
+	if c.Org == "" && c.QueueOpt.Queue == "" {
+		return fmt.Errorf("--org or --queue must be given")
+	}
+
+	apis, err := deep.ParseAPISelection(c.API)
+	if err != nil {
+		return err
+	}
+
+	filter, err := c.Filter.filter()
+	if err != nil {
+		return err
+	}
+
+	entities, err := utils.ParseEntities(c.Entities)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Metrics.serve(); err != nil {
+		return err
+	}
+
+	shutdown, err := c.Tracing.start()
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
 	db, err := c.Postgres.initDB()
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
-	client, err := newClient(c.Token)
+	var targets []string
+	if c.Org != "" {
+		targets = []string{c.Org}
+	}
+
+	r, err := startRun(db, "", deepMode, targets)
 	if err != nil {
 		return err
 	}
 
-	broker, err := queue.NewBroker(c.QueueOpt.Broker)
+	err = c.run(ctx, db, r, apis, entities, filter)
+	if err := r.finish(err); err != nil {
+		log.Errorf(err, "unable to finish the run")
+	}
+
+	c.Report.print(r)
+
+	// the workers run until they are stopped, it's their normal exit
+	if err == context.Canceled {
+		log.Infof("workers stopped")
+		return nil
+	}
+
+	return err
+}
+
+func (c *DeepCommand) run(
+	ctx context.Context,
+	db *sql.DB,
+	r *run,
+	apis map[deep.SyncTaskType]deep.API,
+	entities utils.Entities,
+	filter *utils.RepositoryFilter,
+) error {
+	client, err := c.GitHub.newClient(c.Token, r.Stats)
 	if err != nil {
 		return err
 	}
 
-	qName := c.QueueOpt.Queue
-	if qName == "" {
-		qName = c.Org
+	queue, err := c.QueueOpt.openQueue(c.Org)
+	if err != nil {
+		return err
 	}
-	queue, err := broker.Queue(qName)
+
+	dedup, err := c.QueueOpt.dedup(db)
 	if err != nil {
 		return err
 	}
 
-	syncer := deep.NewSyncer(db, client, queue)
+	syncer := deep.NewSyncer(db, client, queue, r.Stats)
+	syncer.API = apis
+	syncer.Entities = entities
+	syncer.Progress = deep.NewProgress(db, progressTableName)
+	syncer.Dedup = dedup
+	syncer.Repository.Filter = filter
+	health.watchWorker(syncer)
+
+	// the organization job is only published by the enqueue subcommand, so
+	// starting several workers doesn't repeat the sync of the organization
 
-	go func() {
-		err := syncer.DoOrganization(c.Org)
-		if err != nil {
-			log.Errorf(err, "syncer.DoOrganization finished with error")
-		}
-	}()
+	// the workers run until they fail, so the run is saved periodically to
+	// follow its progress
+	stop := r.saveEvery(runSaveInterval)
+	defer stop()
 
-	return syncer.Wait()
+	return syncer.Wait(ctx)
 }
@@ -0,0 +1,74 @@
+package subcmd
+
+import (
+	"context"
+
+	"github.com/src-d/ghsync/deep"
+
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+type EnqueueCommand struct {
+	cli.Command `name:"enqueue" short-description:"Publish the deep sync job of an organization" long-description:"Publish the deep sync job of a GitHub organization or user, it's synced by the deep worker that handles it"`
+
+	Org string `long:"org" env:"GHSYNC_ORG" description:"Name of the GitHub organization or user" required:"true"`
+
+	QueueOpt QueueOpt    `group:"go-queue connection options"`
+	Tracing  TracingOpt  `group:"Tracing options"`
+	Postgres PostgresOpt `group:"PostgreSQL connection options"`
+}
+
+func (c *EnqueueCommand) ExecuteContext(ctx context.Context, args []string) error {
+	shutdown, err := c.Tracing.start()
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
+	db, err := c.Postgres.initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// publishing the job resets the progress of the organization
+	lock, err := lockOwners(ctx, db, []string{c.Org})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := lock.Unlock(); err != nil {
+			log.Errorf(err, "unable to release the owner locks")
+		}
+	}()
+
+	q, err := c.QueueOpt.openQueue(c.Org)
+	if err != nil {
+		return err
+	}
+
+	dedup, err := c.QueueOpt.dedup(db)
+	if err != nil {
+		return err
+	}
+
+	// the jobs of the whole organization are published in the lane of its
+	// job, so it goes to the normal lane not to delay the high one
+	ctx, err = c.QueueOpt.withLane(ctx, deep.NormalLane)
+	if err != nil {
+		return err
+	}
+
+	syncer := deep.NewSyncer(db, nil, q, nil)
+	syncer.Progress = deep.NewProgress(db, progressTableName)
+	syncer.Dedup = dedup
+
+	if err := syncer.QueueOrganization(ctx, c.Org); err != nil {
+		return err
+	}
+
+	log.With(log.Fields{"org": c.Org}).Infof("organization sync job published")
+	return nil
+}
@@ -0,0 +1,331 @@
+package subcmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/src-d/ghsync/utils"
+
+	"github.com/streadway/amqp"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// healthCheckTimeout is the time given to each check of /readyz.
+const healthCheckTimeout = 5 * time.Second
+
+var health = &healthChecks{
+	ready:   make(map[string]func(context.Context) error),
+	started: time.Now(),
+}
+
+// healthChecks are the checks reported in /healthz and /readyz. The commands
+// register the DB, the broker and the deep worker as they are opened.
+type healthChecks struct {
+	m sync.Mutex
+	// ready are the dependencies checked by /readyz
+	ready map[string]func(context.Context) error
+	// queues are the queues opened, by broker
+	queues map[string][]string
+	// worker is the deep worker watched, it's nil if the process is not a
+	// deep worker
+	worker  worker
+	started time.Time
+	maxIdle time.Duration
+}
+
+// healthReport is the body of the /healthz and /readyz responses.
+type healthReport struct {
+	// Status is ok, failing, or sleeping when the process is waiting for the
+	// GitHub limits
+	Status      string             `json:"status"`
+	Checks      map[string]string  `json:"checks,omitempty"`
+	LastJob     *time.Time         `json:"last_job,omitempty"`
+	RunningJob  *time.Time         `json:"running_job,omitempty"`
+	Idle        string             `json:"idle,omitempty"`
+	LimitSleeps []utils.LimitSleep `json:"limit_sleeps,omitempty"`
+}
+
+// addReady adds a dependency checked by /readyz.
+func (h *healthChecks) addReady(name string, check func(context.Context) error) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.ready[name] = check
+}
+
+// addQueue adds a queue of the broker, the broker connectivity is checked by
+// /readyz and its waiting jobs tell apart an idle worker from a hung one.
+func (h *healthChecks) addQueue(broker, name string) {
+	h.m.Lock()
+	if h.queues == nil {
+		h.queues = make(map[string][]string)
+	}
+
+	known := false
+	for _, n := range h.queues[broker] {
+		known = known || n == name
+	}
+
+	if !known {
+		h.queues[broker] = append(h.queues[broker], name)
+	}
+	h.m.Unlock()
+
+	h.addReady("broker", h.checkBrokers)
+}
+
+// worker is the activity of a deep worker, as reported by deep.Syncer.
+type worker interface {
+	// LastJob returns when the last job was handled
+	LastJob() time.Time
+	// RunningJob returns when the job being handled started
+	RunningJob() time.Time
+	// LastProgress returns when the job being handled last made progress
+	LastProgress() time.Time
+}
+
+// watchWorker makes /healthz fail if the worker hasn't handled any job, nor
+// made progress in the one being handled, for longer than the max idle time
+// while there are jobs waiting.
+func (h *healthChecks) watchWorker(w worker) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.worker = w
+}
+
+func (h *healthChecks) setMaxIdle(d time.Duration) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.maxIdle = d
+}
+
+func (h *healthChecks) register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.serveHealthz)
+	mux.HandleFunc("/readyz", h.serveReadyz)
+}
+
+// serveHealthz reports if the process is alive. It only fails for deep
+// workers that stopped handling jobs, or making progress in the one being
+// handled, while there are jobs waiting and no GitHub limit to wait for.
+func (h *healthChecks) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	h.m.Lock()
+	worker, started, maxIdle := h.worker, h.started, h.maxIdle
+	h.m.Unlock()
+
+	report := &healthReport{
+		Status:      "ok",
+		LimitSleeps: utils.CurrentLimitSleeps(),
+	}
+
+	if worker != nil {
+		since := started
+		if t := worker.LastJob(); !t.IsZero() {
+			report.LastJob = &t
+			since = t
+		}
+
+		stalled := "no job handled"
+		if t := worker.RunningJob(); !t.IsZero() {
+			report.RunningJob = &t
+			since = worker.LastProgress()
+			stalled = "no progress in the running job"
+		}
+
+		idle := time.Since(since).Round(time.Second)
+		report.Idle = idle.String()
+
+		if maxIdle > 0 && idle > maxIdle && len(report.LimitSleeps) == 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+			msg := h.checkWaiting(ctx)
+			cancel()
+
+			if msg != "" {
+				report.Status = "failing"
+				report.Checks = map[string]string{"jobs": fmt.Sprintf(
+					"%s for %s, %s", stalled, idle, msg)}
+			}
+		}
+	}
+
+	if report.Status == "ok" && len(report.LimitSleeps) != 0 {
+		report.Status = "sleeping"
+	}
+
+	writeHealthReport(w, report)
+}
+
+// serveReadyz reports if the DB and the broker are reachable.
+func (h *healthChecks) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	h.m.Lock()
+	checks := make(map[string]func(context.Context) error, len(h.ready))
+	for name, check := range h.ready {
+		checks[name] = check
+	}
+	h.m.Unlock()
+
+	report := &healthReport{
+		Status:      "ok",
+		Checks:      make(map[string]string, len(checks)),
+		LimitSleeps: utils.CurrentLimitSleeps(),
+	}
+
+	for name, check := range checks {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		err := check(ctx)
+		cancel()
+
+		if err != nil {
+			report.Status = "failing"
+			report.Checks[name] = err.Error()
+			continue
+		}
+
+		report.Checks[name] = "ok"
+	}
+
+	writeHealthReport(w, report)
+}
+
+// checkWaiting returns why the idle worker is considered hung, or an empty
+// string if there are no jobs waiting in its queues.
+func (h *healthChecks) checkWaiting(ctx context.Context) string {
+	queues := h.openQueues()
+
+	waiting := 0
+	for broker, names := range queues {
+		if !isAMQPBroker(broker) {
+			return "the depth of the queue is unknown"
+		}
+
+		for _, name := range names {
+			n, err := inspectQueue(ctx, broker, name)
+			if err != nil {
+				return fmt.Sprintf("unable to read the depth of queue %s: %v", name, err)
+			}
+
+			waiting += n
+		}
+	}
+
+	if waiting == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d jobs waiting", waiting)
+}
+
+// checkBrokers checks that the queues opened can be reached. Only AMQP
+// brokers are checked, the in-memory ones are always reachable.
+func (h *healthChecks) checkBrokers(ctx context.Context) error {
+	queues := h.openQueues()
+
+	for broker, names := range queues {
+		if !isAMQPBroker(broker) {
+			continue
+		}
+
+		for _, name := range names {
+			if _, err := inspectQueue(ctx, broker, name); err != nil {
+				return fmt.Errorf("queue %s: %v", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// openQueues returns a copy of the queues opened, by broker.
+func (h *healthChecks) openQueues() map[string][]string {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	queues := make(map[string][]string, len(h.queues))
+	for broker, names := range h.queues {
+		queues[broker] = append([]string(nil), names...)
+	}
+
+	return queues
+}
+
+func isAMQPBroker(broker string) bool {
+	return strings.HasPrefix(broker, "amqp://") || strings.HasPrefix(broker, "amqps://")
+}
+
+// inspectQueue returns the number of jobs waiting in an AMQP queue. It gives
+// up when ctx is done.
+func inspectQueue(ctx context.Context, broker, name string) (int, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(healthCheckTimeout)
+	}
+
+	var netConn net.Conn
+	conn, err := amqp.DialConfig(broker, amqp.Config{
+		Dial: func(network, addr string) (net.Conn, error) {
+			c, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+
+			// the deadline bounds the AMQP handshake, amqp clears it once
+			// the connection is open
+			if err := c.SetDeadline(deadline); err != nil {
+				c.Close()
+				return nil, err
+			}
+
+			netConn = c
+			return c, nil
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	type result struct {
+		messages int
+		err      error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		channel, err := conn.Channel()
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer channel.Close()
+
+		q, err := channel.QueueInspect(name)
+		done <- result{messages: q.Messages, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		conn.Close()
+		return r.messages, r.err
+	case <-ctx.Done():
+		// closing the network connection unblocks the inspection
+		netConn.Close()
+		return 0, ctx.Err()
+	}
+}
+
+func writeHealthReport(w http.ResponseWriter, report *healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == "failing" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Warningf("unable to write the health report: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package subcmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/src-d/ghsync/deep"
+	"github.com/src-d/ghsync/utils"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+type ItemCommand struct {
+	cli.Command `name:"item" short-description:"Sync of a single GitHub issue or pull request" long-description:"Deep sync of a single GitHub issue or pull request, including its reviews and comments"`
+
+	Token string `long:"token" env:"GHSYNC_TOKEN" description:"GitHub personal access token. Several comma-separated tokens can be given to rotate between them" required:"true"`
+
+	Args struct {
+		URL string `positional-arg-name:"url" description:"URL of the issue or pull request"`
+	} `positional-args:"yes" required:"yes"`
+
+	Enqueue bool `long:"enqueue" description:"Publish a deep sync job for the issue or pull request to be handled by the deep workers, instead of syncing it"`
+
+	QueueOpt QueueOpt    `group:"go-queue connection options"`
+	Report   ReportOpt   `group:"Report options"`
+	Metrics  MetricsOpt  `group:"Metrics options"`
+	Tracing  TracingOpt  `group:"Tracing options"`
+	GitHub   GitHubOpt   `group:"GitHub Enterprise options"`
+	Postgres PostgresOpt `group:"PostgreSQL connection options"`
+}
+
+func (c *ItemCommand) ExecuteContext(ctx context.Context, args []string) error {
+	parser, err := c.GitHub.urlParser()
+	if err != nil {
+		return err
+	}
+
+	isPR, err := isPullRequestURL(c.Args.URL)
+	if err != nil {
+		return err
+	}
+
+	parse := parser.ParseIssueURL
+	if isPR {
+		parse = parser.ParsePullRequestURL
+	}
+
+	owner, name, number, err := parse(c.Args.URL)
+	if err != nil {
+		return err
+	}
+
+	shutdown, err := c.Tracing.start()
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
+	logger := log.New(log.Fields{"owner": owner, "repository": name, "number": number})
+	if c.Enqueue {
+		return c.enqueue(ctx, isPR, owner, name, number, logger)
+	}
+
+	if err := c.Metrics.serve(); err != nil {
+		return err
+	}
+
+	db, err := c.Postgres.initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	r, err := startRun(db, "", deepMode, []string{c.Args.URL})
+	if err != nil {
+		return err
+	}
+
+	client, err := c.GitHub.newClient(c.Token, r.Stats)
+	if err == nil {
+		err = c.sync(ctx, db, client, r.Stats, isPR, owner, name, number, logger)
+	}
+
+	if err := r.finish(err); err != nil {
+		log.Errorf(err, "unable to finish the run")
+	}
+
+	c.Report.print(r)
+	return err
+}
+
+func (c *ItemCommand) sync(
+	ctx context.Context,
+	db *sql.DB,
+	client *github.Client,
+	stats *utils.Stats,
+	isPR bool,
+	owner, name string,
+	number int,
+	logger log.Logger,
+) error {
+	syncer := deep.NewSyncer(db, client, nil, stats)
+	logger.Infof("starting sync")
+
+	var err error
+	if isPR {
+		err = syncer.SyncPullRequest(ctx, owner, name, number)
+	} else {
+		err = syncer.SyncIssue(ctx, owner, name, number)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("finished sync")
+	return nil
+}
+
+// enqueue publishes the job of the issue or pull request, in the high lane
+// unless another one is given.
+func (c *ItemCommand) enqueue(
+	ctx context.Context,
+	isPR bool,
+	owner, name string,
+	number int,
+	logger log.Logger,
+) error {
+	db, err := c.Postgres.initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	q, err := c.QueueOpt.openQueue(owner)
+	if err != nil {
+		return err
+	}
+
+	ctx, err = c.QueueOpt.withLane(ctx, deep.HighLane)
+	if err != nil {
+		return err
+	}
+
+	// the job is requested explicitly, so it's never skipped as duplicated
+	syncer := deep.NewSyncer(db, nil, q, nil)
+	syncer.Progress = deep.NewProgress(db, progressTableName)
+	syncer.Dedup = nil
+
+	if isPR {
+		err = syncer.QueuePullRequest(ctx, owner, name, number)
+	} else {
+		err = syncer.QueueIssue(ctx, owner, name, number)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("sync job published")
+	return nil
+}
+
+// isPullRequestURL returns true for the URLs of pull requests, and false for
+// the issues ones.
+func isPullRequestURL(rawurl string) (bool, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false, err
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) >= 2 {
+		switch parts[len(parts)-2] {
+		case "pull", "pulls":
+			return true, nil
+		case "issues":
+			return false, nil
+		}
+	}
+
+	return false, fmt.Errorf("%s is not an issue or pull request URL", rawurl)
+}
@@ -0,0 +1,135 @@
+package subcmd
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/streadway/amqp"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+type MetricsOpt struct {
+	Addr    string        `long:"metrics-addr" env:"GHSYNC_METRICS_ADDR" description:"Address of an HTTP listener exposing Prometheus metrics in /metrics and health checks in /healthz and /readyz, e.g. :9100. Nothing is exposed if it's not set"`
+	MaxIdle time.Duration `long:"health-max-idle" env:"GHSYNC_HEALTH_MAX_IDLE" default:"30m" description:"/healthz fails if a deep worker doesn't handle any job for this long while there are jobs waiting and no GitHub limit to wait for. 0 disables the check"`
+}
+
+// serve starts the metrics and health checks listener in the background, if
+// an address was given. It runs until the process exits.
+func (o MetricsOpt) serve() error {
+	if o.Addr == "" {
+		return nil
+	}
+
+	health.setMaxIdle(o.MaxIdle)
+
+	l, err := net.Listen("tcp", o.Addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	health.register(mux)
+
+	go func() {
+		if err := http.Serve(l, mux); err != nil {
+			log.Errorf(err, "metrics listener stopped")
+		}
+	}()
+
+	log.With(log.Fields{"addr": l.Addr().String()}).Infof("serving metrics")
+	return nil
+}
+
+var queueDepth = newQueueDepthCollector()
+
+func init() {
+	prometheus.MustRegister(queueDepth)
+}
+
+// queueDepthCollector reports the jobs waiting in the queues opened by the
+// process. Only AMQP brokers are supported, the depth of the queues is read
+// from the broker on every scrape.
+type queueDepthCollector struct {
+	desc *prometheus.Desc
+
+	m      sync.Mutex
+	queues map[string]map[string]bool
+}
+
+func newQueueDepthCollector() *queueDepthCollector {
+	return &queueDepthCollector{
+		desc: prometheus.NewDesc(
+			"ghsync_queue_depth",
+			"Jobs waiting in the deep sync queue.",
+			[]string{"queue"}, nil,
+		),
+		queues: make(map[string]map[string]bool),
+	}
+}
+
+// watch adds a queue of the broker to the ones reported.
+func (c *queueDepthCollector) watch(broker, name string) {
+	if !isAMQPBroker(broker) {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.queues[broker] == nil {
+		c.queues[broker] = make(map[string]bool)
+	}
+
+	c.queues[broker][name] = true
+}
+
+func (c *queueDepthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *queueDepthCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for broker, names := range c.queues {
+		if err := c.collectBroker(ch, broker, names); err != nil {
+			log.Warningf("unable to read the depth of the queues: %v", err)
+		}
+	}
+}
+
+func (c *queueDepthCollector) collectBroker(
+	ch chan<- prometheus.Metric,
+	broker string,
+	names map[string]bool,
+) error {
+	conn, err := amqp.Dial(broker)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for name := range names {
+		// a failed inspection closes the channel, so each queue uses its own
+		channel, err := conn.Channel()
+		if err != nil {
+			return err
+		}
+
+		q, err := channel.QueueInspect(name)
+		if err != nil {
+			log.Warningf("unable to read the depth of queue %s: %v", name, err)
+			continue
+		}
+
+		channel.Close()
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(q.Messages), name)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package subcmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/src-d/ghsync/deep"
+	"github.com/src-d/ghsync/shallow"
+	"github.com/src-d/ghsync/utils"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+type RepoCommand struct {
+	cli.Command `name:"repo" short-description:"Sync of a single GitHub repository" long-description:"Sync of a single GitHub repository. By default it's a deep sync, updating the existing records, use --shallow to only write the new ones"`
+
+	Token   string `long:"token" env:"GHSYNC_TOKEN" description:"GitHub personal access token. Several comma-separated tokens can be given to rotate between them" required:"true"`
+	Repo    string `long:"repo" env:"GHSYNC_REPO" description:"Repository to sync, as owner/name" required:"true"`
+	Shallow bool   `long:"shallow" description:"Shallow sync of the repository, it only writes the records not in the DB yet, so a repository already synced is skipped"`
+	Deep    bool   `long:"deep" hidden:"true" description:"Deep sync of the repository, the default"`
+	Enqueue bool   `long:"enqueue" description:"Publish a deep sync job for the repository to be handled by the deep workers, instead of syncing it. The job is synced with the --entities and --api given, if any"`
+	API     string `long:"api" env:"GHSYNC_API" description:"GitHub API used to retrieve issues and pull requests in deep mode, rest or graphql. It can be set per entity, e.g. pull-request:graphql,issue:rest. REST is used if it's not given, or the API of the workers with --enqueue"`
+
+	Entities []string `long:"entities" env:"GHSYNC_ENTITIES" env-delim:"," description:"Entities to sync: organizations, repositories, issues, pull_requests, reviews, comments and users. All of them are synced if it's not given"`
+
+	QueueOpt QueueOpt    `group:"go-queue connection options"`
+	Report   ReportOpt   `group:"Report options"`
+	Metrics  MetricsOpt  `group:"Metrics options"`
+	Tracing  TracingOpt  `group:"Tracing options"`
+	GitHub   GitHubOpt   `group:"GitHub Enterprise options"`
+	Postgres PostgresOpt `group:"PostgreSQL connection options"`
+}
+
+func (c *RepoCommand) ExecuteContext(ctx context.Context, args []string) error {
+	owner, name, err := splitRepositoryName(c.Repo)
+	if err != nil {
+		return err
+	}
+
+	logger := log.New(log.Fields{"owner": owner, "repository": name})
+
+	if c.Shallow && (c.Deep || c.Enqueue) {
+		return fmt.Errorf("--shallow can't be used with --deep or --enqueue")
+	}
+
+	entities, err := utils.ParseEntities(c.Entities)
+	if err != nil {
+		return err
+	}
+
+	apis, err := deep.ParseAPISelection(c.API)
+	if err != nil {
+		return err
+	}
+
+	if c.Enqueue {
+		return c.enqueue(ctx, owner, name, logger)
+	}
+
+	if err := c.Metrics.serve(); err != nil {
+		return err
+	}
+
+	shutdown, err := c.Tracing.start()
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
+	db, err := c.Postgres.initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	lock, err := lockOwners(ctx, db, []string{owner})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := lock.Unlock(); err != nil {
+			log.Errorf(err, "unable to release the owner locks")
+		}
+	}()
+
+	mode := deepMode
+	if c.Shallow {
+		mode = shallowMode
+	}
+
+	r, err := startRun(db, "", mode, []string{c.Repo})
+	if err != nil {
+		return err
+	}
+
+	client, err := c.GitHub.newClient(c.Token, r.Stats)
+	if err == nil {
+		err = c.sync(ctx, db, client, r.Stats, apis, entities, owner, name, logger)
+	}
+
+	if err := r.finish(err); err != nil {
+		log.Errorf(err, "unable to finish the run")
+	}
+
+	c.Report.print(r)
+	return err
+}
+
+func (c *RepoCommand) sync(
+	ctx context.Context,
+	db *sql.DB,
+	client *github.Client,
+	stats *utils.Stats,
+	apis map[deep.SyncTaskType]deep.API,
+	entities utils.Entities,
+	owner, name string,
+	logger log.Logger,
+) error {
+	if c.Shallow {
+		cursors := shallow.NewCursors(db, cursorTableName)
+		syncer := shallow.NewRepositorySyncer(db, client, statusTableName, cursors, nil, nil, entities, 1, stats)
+		return syncer.SyncRepository(ctx, owner, name, logger)
+	}
+
+	syncer := deep.NewSyncer(db, client, nil, stats)
+	syncer.API = apis
+	syncer.Entities = entities
+
+	logger.Infof("starting deep sync")
+	if err := syncer.SyncRepository(ctx, owner, name); err != nil {
+		return err
+	}
+
+	logger.Infof("finished deep sync")
+	return nil
+}
+
+// enqueue publishes the job of the repository, in the high lane unless
+// another one is given, with the entities and API given. The run is recorded
+// so the request shows up in the status.
+func (c *RepoCommand) enqueue(ctx context.Context, owner, name string, logger log.Logger) error {
+	shutdown, err := c.Tracing.start()
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
+	db, err := c.Postgres.initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	r, err := startRun(db, "", deepMode, []string{c.Repo})
+	if err != nil {
+		return err
+	}
+
+	err = c.queueRepository(ctx, db, owner, name)
+	if err := r.finish(err); err != nil {
+		log.Errorf(err, "unable to finish the run")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("repository sync job published")
+	return nil
+}
+
+func (c *RepoCommand) queueRepository(ctx context.Context, db *sql.DB, owner, name string) error {
+	q, err := c.QueueOpt.openQueue(owner)
+	if err != nil {
+		return err
+	}
+
+	ctx, err = c.QueueOpt.withLane(ctx, deep.HighLane)
+	if err != nil {
+		return err
+	}
+
+	// the worker handling the job syncs the entities and uses the API given,
+	// instead of its own
+	ctx = deep.WithOptions(ctx, deep.JobOptions{Entities: c.Entities, API: c.API})
+
+	// the job is requested explicitly, so it's never skipped as duplicated
+	syncer := deep.NewSyncer(db, nil, q, nil)
+	syncer.Progress = deep.NewProgress(db, progressTableName)
+	syncer.Dedup = nil
+
+	return syncer.QueueRepository(ctx, owner, name)
+}
+
+// splitRepositoryName splits a repository full name, like src-d/ghsync, into
+// its owner and name.
+func splitRepositoryName(fullName string) (owner, name string, err error) {
+	parts := strings.Split(fullName, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid repository %q, it must be owner/name", fullName)
+	}
+
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,400 @@
+package subcmd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/src-d/ghsync/shallow"
+	"github.com/src-d/ghsync/utils"
+
+	"gopkg.in/src-d/go-log.v1"
+)
+
+const runsTableName = "sync_runs"
+
+// repositorySyncsTableName is the table with the last successful sync of
+// each repository.
+const repositorySyncsTableName = "repository_syncs"
+
+// runSaveInterval is how often the long runs are saved.
+const runSaveInterval = time.Minute
+
+const (
+	runRunning   = "running"
+	runSuccess   = "success"
+	runFailed    = "failed"
+	runSkipped   = "skipped"
+	runCancelled = "cancelled"
+)
+
+func createRunsTable(db *sql.DB) error {
+	log.Debugf("creating runs table '%s'", runsTableName)
+
+	stm := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+    id serial PRIMARY KEY,
+    target VARCHAR (255) NOT NULL DEFAULT '',
+    mode VARCHAR (20) NOT NULL,
+    targets TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    finished_at TIMESTAMP WITH TIME ZONE DEFAULT NULL,
+    result VARCHAR (20) NOT NULL,
+    entities JSONB NOT NULL DEFAULT '{}',
+    api_calls BIGINT NOT NULL DEFAULT 0,
+    error TEXT DEFAULT NULL
+);`, runsTableName)
+	log.Debugf("running statement: %s", stm)
+	if _, err := db.Exec(stm); err != nil {
+		return fmt.Errorf("an error occured while ensuring the runs table: %v", err)
+	}
+
+	stm = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+    owner VARCHAR (255) NOT NULL,
+    name VARCHAR (255) NOT NULL,
+    mode VARCHAR (20) NOT NULL,
+    run_id INTEGER NOT NULL,
+    synced_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (owner, name)
+);`, repositorySyncsTableName)
+	log.Debugf("running statement: %s", stm)
+	if _, err := db.Exec(stm); err != nil {
+		return fmt.Errorf("an error occured while ensuring the repository syncs table: %v", err)
+	}
+
+	return nil
+}
+
+// run is a sync run, recorded in the runs table. Stats collects the outcome
+// of the resources synced during the run.
+type run struct {
+	db *sql.DB
+
+	ID         int64
+	Target     string
+	Mode       string
+	Targets    []string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Result     string
+	Err        error
+	Stats      *utils.Stats
+}
+
+// startRun records the start of a run. The target is the name of the config
+// target, if any, and targets the organizations, users or repositories
+// synced.
+func startRun(db *sql.DB, target, mode string, targets []string) (*run, error) {
+	r := &run{
+		db:        db,
+		Target:    target,
+		Mode:      mode,
+		Targets:   targets,
+		StartedAt: time.Now(),
+		Result:    runRunning,
+		Stats:     utils.NewStats(),
+	}
+
+	stm := fmt.Sprintf(
+		"INSERT INTO %s (target, mode, targets, started_at, result) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		runsTableName)
+	err := db.QueryRow(stm, target, mode, strings.Join(targets, ","), r.StartedAt, r.Result).Scan(&r.ID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to record the run: %v", err)
+	}
+
+	return r, nil
+}
+
+// finish records the end of the run, failed if err is not nil or cancelled
+// if the process was stopped.
+func (r *run) finish(err error) error {
+	switch err {
+	case nil:
+		r.Result = runSuccess
+	case context.Canceled:
+		r.Result = runCancelled
+	default:
+		r.Result = runFailed
+	}
+
+	r.Err = err
+	r.FinishedAt = time.Now()
+	return r.save()
+}
+
+// skip records the run as skipped.
+func (r *run) skip() error {
+	r.Result = runSkipped
+	r.FinishedAt = time.Now()
+	return r.save()
+}
+
+// save writes the current state of the run into the runs table.
+func (r *run) save() error {
+	entities, err := json.Marshal(r.Stats.Entities())
+	if err != nil {
+		return err
+	}
+
+	var finishedAt *time.Time
+	if !r.FinishedAt.IsZero() {
+		finishedAt = &r.FinishedAt
+	}
+
+	var msg sql.NullString
+	if r.Err != nil {
+		msg = sql.NullString{String: r.Err.Error(), Valid: true}
+	}
+
+	stm := fmt.Sprintf(
+		"UPDATE %s SET finished_at=$1, result=$2, entities=$3, api_calls=$4, error=$5 WHERE id=$6",
+		runsTableName)
+	_, err = r.db.Exec(stm, finishedAt, r.Result, string(entities), r.Stats.APICalls(), msg, r.ID)
+	if err != nil {
+		return fmt.Errorf("unable to record the state of run %d: %v", r.ID, err)
+	}
+
+	stm = fmt.Sprintf(`INSERT INTO %s (owner, name, mode, run_id) VALUES ($1, $2, $3, $4)
+ON CONFLICT (owner, name) DO UPDATE SET mode=EXCLUDED.mode, run_id=EXCLUDED.run_id, synced_at=now()`,
+		repositorySyncsTableName)
+	for _, fullName := range r.Stats.TakeSyncedRepositories() {
+		parts := strings.SplitN(fullName, "/", 2)
+		if _, err := r.db.Exec(stm, parts[0], parts[1], r.Mode, r.ID); err != nil {
+			return fmt.Errorf("unable to record the sync of repository %s: %v", fullName, err)
+		}
+	}
+
+	return nil
+}
+
+// saveEvery saves the run periodically, for the runs that last long, like
+// the deep workers. The returned function stops it.
+func (r *run) saveEvery(d time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := r.save(); err != nil {
+					log.Errorf(err, "unable to save the run")
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// runReport is the summary of a run printed at exit.
+type runReport struct {
+	ID         int64                              `json:"id"`
+	Target     string                             `json:"target,omitempty"`
+	Mode       string                             `json:"mode"`
+	Targets    []string                           `json:"targets"`
+	StartedAt  time.Time                          `json:"started_at"`
+	FinishedAt time.Time                          `json:"finished_at"`
+	Duration   string                             `json:"duration"`
+	Result     string                             `json:"result"`
+	Entities   map[utils.Entity]utils.EntityStats `json:"entities"`
+	APICalls   int64                              `json:"api_calls"`
+	Error      string                             `json:"error,omitempty"`
+	Failed     []shallow.FailedItem               `json:"failed,omitempty"`
+}
+
+func (r *run) report() *runReport {
+	report := &runReport{
+		ID:         r.ID,
+		Target:     r.Target,
+		Mode:       r.Mode,
+		Targets:    r.Targets,
+		StartedAt:  r.StartedAt,
+		FinishedAt: r.FinishedAt,
+		Duration:   r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond).String(),
+		Result:     r.Result,
+		Entities:   r.Stats.Entities(),
+		APICalls:   r.Stats.APICalls(),
+	}
+
+	if r.Err != nil {
+		report.Error = r.Err.Error()
+	}
+
+	if err, ok := r.Err.(*shallow.FailedItemsError); ok {
+		report.Error = fmt.Sprintf("%d items failed to sync", len(err.Items))
+		report.Failed = err.Items
+	}
+
+	return report
+}
+
+// writeReports writes the summary of the runs in text or json format.
+func writeReports(w io.Writer, format string, runs []*run) error {
+	reports := make([]*runReport, len(runs))
+	for i, r := range runs {
+		reports[i] = r.report()
+	}
+
+	if format == "json" {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(reports)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, r := range reports {
+		name := r.Target
+		if name == "" {
+			name = strings.Join(r.Targets, ", ")
+		}
+
+		fmt.Fprintf(tw, "run %d: %s sync of %s\n", r.ID, r.Mode, name)
+		fmt.Fprintf(tw, "result:\t%s\n", r.Result)
+		if r.Error != "" {
+			fmt.Fprintf(tw, "error:\t%s\n", r.Error)
+		}
+
+		for _, f := range r.Failed {
+			fmt.Fprintf(tw, "failed %s:\t%s: %s\n", f.Entity, f.Item, f.Err)
+		}
+
+		fmt.Fprintf(tw, "duration:\t%s\n", r.Duration)
+		fmt.Fprintf(tw, "api calls:\t%d\n", r.APICalls)
+
+		if len(r.Entities) != 0 {
+			var entities []string
+			for e := range r.Entities {
+				entities = append(entities, string(e))
+			}
+			sort.Strings(entities)
+
+			fmt.Fprintf(tw, "\nentity\tinserted\tupdated\tskipped\tfailed\n")
+			for _, e := range entities {
+				s := r.Entities[utils.Entity(e)]
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", e, s.Inserted, s.Updated, s.Skipped, s.Failed)
+			}
+		}
+
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+// ownerLock is a set of session level PostgreSQL advisory locks, one per
+// organization or user, held while they are synced. So two runs never sync
+// the same organization at the same time and overwrite the status of each
+// other, even if they are started by different processes or commands.
+type ownerLock struct {
+	conn *sql.Conn
+	keys []int64
+}
+
+// tryLockOwners acquires the locks of the organizations or users. If any of
+// them is already held by another run, the ones acquired are released and
+// it's returned as busy, with a nil lock.
+func tryLockOwners(ctx context.Context, db *sql.DB, owners []string) (l *ownerLock, busy string, err error) {
+	// the locks belong to the session, so the same connection must be used
+	// to release them
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	l = &ownerLock{conn: conn}
+	for _, o := range uniqueOwners(owners) {
+		key := ownerLockKey(o)
+
+		var locked bool
+		err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked)
+		if err != nil || !locked {
+			if err := l.Unlock(); err != nil {
+				log.Errorf(err, "unable to release the owner locks")
+			}
+
+			return nil, o, err
+		}
+
+		l.keys = append(l.keys, key)
+	}
+
+	return l, "", nil
+}
+
+// lockOwners acquires the locks of the organizations or users, failing if
+// any of them is being synced by another run.
+func lockOwners(ctx context.Context, db *sql.DB, owners []string) (*ownerLock, error) {
+	l, busy, err := tryLockOwners(ctx, db, owners)
+	if err != nil {
+		return nil, fmt.Errorf("unable to acquire the lock of %s: %v", busy, err)
+	}
+
+	if l == nil {
+		return nil, fmt.Errorf("%s is being synced by another run", busy)
+	}
+
+	return l, nil
+}
+
+// ownerLockKey returns the advisory lock key of an organization or user, the
+// GitHub logins are case insensitive.
+func ownerLockKey(owner string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("ghsync/owner/" + strings.ToLower(owner)))
+	return int64(h.Sum64())
+}
+
+// uniqueOwners returns the owners without duplicates, sorted so the locks
+// are always acquired in the same order.
+func uniqueOwners(owners []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, o := range owners {
+		o = strings.ToLower(o)
+		if seen[o] {
+			continue
+		}
+
+		seen[o] = true
+		unique = append(unique, o)
+	}
+
+	sort.Strings(unique)
+	return unique
+}
+
+// Unlock releases the locks, it can be called on a nil lock.
+func (l *ownerLock) Unlock() error {
+	if l == nil {
+		return nil
+	}
+
+	defer l.conn.Close()
+
+	for _, key := range l.keys {
+		_, err := l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
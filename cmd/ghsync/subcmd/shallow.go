@@ -1,12 +1,15 @@
 package subcmd
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
 
 	"github.com/src-d/ghsync/shallow"
+	"github.com/src-d/ghsync/utils"
 
+	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-cli.v0"
 	"gopkg.in/src-d/go-log.v1"
 )
@@ -14,15 +17,22 @@ import (
 type ShallowCommand struct {
 	cli.Command `name:"shallow" short-description:"Shallow sync of GitHub data" long-description:"Shallow sync of GitHub data"`
 
-	Token string `long:"token" env:"GHSYNC_TOKEN" description:"GitHub personal access token" required:"true"`
-	Orgs  string `long:"orgs" env:"GHSYNC_ORGS" description:"Comma-separated list of GitHub organization names" required:"true"`
+	Token string `long:"token" env:"GHSYNC_TOKEN" description:"GitHub personal access token. Several comma-separated tokens can be given to rotate between them" required:"true"`
+	Orgs  string `long:"orgs" env:"GHSYNC_ORGS" description:"Comma-separated list of GitHub organization or user names" required:"true"`
 
-	NoForks bool `long:"no-forks"  env:"GHSYNC_NO_FORKS" description:"github forked repositories will be skipped"`
+	Entities    []string `long:"entities" env:"GHSYNC_ENTITIES" env-delim:"," description:"Entities to sync: organizations, repositories, issues, pull_requests, reviews, comments and users. All of them are synced if it's not given"`
+	Parallelism int      `long:"parallelism" env:"GHSYNC_PARALLELISM" default:"1" description:"Number of organizations, and of repositories of each organization, synced in parallel"`
+	OnError     string   `long:"on-error" env:"GHSYNC_ON_ERROR" choice:"abort" choice:"continue" default:"abort" description:"What to do when an organization, repository or user fails to sync: abort the sync, or record the failure and continue with the rest"`
 
-	Postgres PostgresOpt `group:"PostgreSQL connection options"`
+	Filter   RepositoryFilterOpt `group:"Repository filter options"`
+	Report   ReportOpt           `group:"Report options"`
+	Metrics  MetricsOpt          `group:"Metrics options"`
+	Tracing  TracingOpt          `group:"Tracing options"`
+	GitHub   GitHubOpt           `group:"GitHub Enterprise options"`
+	Postgres PostgresOpt         `group:"PostgreSQL connection options"`
 }
 
-func (c *ShallowCommand) Execute(args []string) error {
+func (c *ShallowCommand) ExecuteContext(ctx context.Context, args []string) error {
 	if c.Orgs == "" {
 		log.Warningf("no organizations found, at least one " +
 			"organization must be provided")
@@ -30,34 +40,104 @@ func (c *ShallowCommand) Execute(args []string) error {
 		return nil
 	}
 
-	db, err := c.Postgres.initDB()
+	filter, err := c.Filter.filter()
+	if err != nil {
+		return err
+	}
+
+	entities, err := utils.ParseEntities(c.Entities)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	client, err := newClient(c.Token)
+	onError, err := shallow.ParseOnError(c.OnError)
 	if err != nil {
 		return err
 	}
 
+	if err := c.Metrics.serve(); err != nil {
+		return err
+	}
+
+	shutdown, err := c.Tracing.start()
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
+	db, err := c.Postgres.initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
 	orgs := strings.Split(c.Orgs, ",")
-	if err = c.initStatus(db, statusTableName, orgs); err != nil {
+	lock, err := lockOwners(ctx, db, orgs)
+	if err != nil {
 		return err
 	}
 
-	orgSyncer := shallow.NewOrganizationSyncer(db, client, statusTableName, c.NoForks)
-	for _, o := range orgs {
-		err = orgSyncer.Sync(o)
-		if err != nil {
-			return err
+	defer func() {
+		if err := lock.Unlock(); err != nil {
+			log.Errorf(err, "unable to release the owner locks")
 		}
+	}()
+
+	r, err := startRun(db, "", shallowMode, orgs)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	failures := shallow.NewFailures(db, failureTableName, r.ID, onError)
+	client, err := c.GitHub.newClient(c.Token, r.Stats)
+	if err == nil {
+		err = syncShallow(ctx, db, client, filter, entities, r.Stats, failures, c.Parallelism, orgs)
+	}
+
+	if err == nil {
+		err = failures.Err()
+	}
+
+	if err := r.finish(err); err != nil {
+		log.Errorf(err, "unable to finish the run")
+	}
+
+	c.Report.print(r)
+	return err
+}
+
+// syncShallow runs a shallow sync of the given organizations or users, with
+// up to parallelism of them, and of the repositories of each one, synced at
+// the same time. The items failed are handled with failures, that can be nil
+// to abort on the first one.
+func syncShallow(
+	ctx context.Context,
+	db *sql.DB,
+	client *github.Client,
+	filter *utils.RepositoryFilter,
+	entities utils.Entities,
+	stats *utils.Stats,
+	failures *shallow.Failures,
+	parallelism int,
+	orgs []string,
+) error {
+	if err := initStatus(db, statusTableName, orgs); err != nil {
+		return err
+	}
+
+	cursors := shallow.NewCursors(db, cursorTableName)
+	orgSyncer := shallow.NewOrganizationSyncer(db, client, statusTableName,
+		cursors, failures, filter, entities, parallelism, stats)
+	return utils.RunParallel(ctx, parallelism, len(orgs), func(ctx context.Context, i int) error {
+		if err := orgSyncer.Sync(ctx, orgs[i]); err != nil {
+			return failures.Handle(ctx, orgs[i], utils.OrganizationEntity, orgs[i], err)
+		}
+
+		return nil
+	})
 }
 
-func (c *ShallowCommand) initStatus(db *sql.DB, tableName string, orgs []string) error {
+func initStatus(db *sql.DB, tableName string, orgs []string) error {
 	log.Debugf("initializing status table for orgs: %v", orgs)
 	var b strings.Builder
 
@@ -0,0 +1,457 @@
+package subcmd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/src-d/ghsync/utils"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/lib/pq"
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+const progressBarWidth = 30
+
+// entityTables are the tables counted by the status command, with the column
+// holding the organization of each row.
+var entityTables = []struct {
+	Table string
+	Owner string
+}{
+	{"repositories", "owner_login"},
+	{"issues", "repository_owner"},
+	{"issue_comments", "repository_owner"},
+	{"pull_requests", "repository_owner"},
+	{"pull_request_comments", "repository_owner"},
+	{"pull_request_reviews", "repository_owner"},
+}
+
+type StatusCommand struct {
+	cli.Command `name:"status" short-description:"Show the state of the syncs" long-description:"Show the state of the syncs of each organization as stored in the DB: the progress of the shallow and deep syncs, the number of resources of each entity and the last sync of each repository"`
+
+	Orgs   []string `long:"org" description:"Organization to show, all of them are shown if it's not given"`
+	Format string   `long:"format" choice:"table" choice:"json" default:"table" description:"Output format"`
+	Token  string   `long:"token" env:"GHSYNC_TOKEN" description:"GitHub personal access token to show its rate limit budget. Several comma-separated tokens can be given"`
+
+	GitHub   GitHubOpt   `group:"GitHub Enterprise options"`
+	Postgres PostgresOpt `group:"PostgreSQL connection options"`
+}
+
+// statusReport is the state of the syncs shown by the status command.
+type statusReport struct {
+	MigrationVersion uint         `json:"migration_version"`
+	MigrationDirty   bool         `json:"migration_dirty"`
+	RateLimits       []*tokenRate `json:"rate_limits,omitempty"`
+	Orgs             []*orgStatus `json:"organizations"`
+	orgs             map[string]*orgStatus
+}
+
+// tokenRate is the rate limit budget of a token. The token is masked.
+type tokenRate struct {
+	Token     string    `json:"token"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type orgStatus struct {
+	Org          string            `json:"organization"`
+	Entities     map[string]int64  `json:"entities"`
+	Shallow      []*shallowStatus  `json:"shallow"`
+	Deep         []*deepStatus     `json:"deep"`
+	Repositories []*repositorySync `json:"repositories"`
+}
+
+// shallowStatus is a row of the status table.
+type shallowStatus struct {
+	Entity string `json:"entity"`
+	Done   int    `json:"done"`
+	Failed int    `json:"failed"`
+	Total  *int64 `json:"total"`
+}
+
+// deepStatus is a row of the deep progress table.
+type deepStatus struct {
+	Task      string    `json:"task"`
+	Published int       `json:"published"`
+	Done      int       `json:"done"`
+	Failed    int       `json:"failed"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// repositorySync is the last successful sync of a repository.
+type repositorySync struct {
+	Name     string    `json:"name"`
+	Mode     string    `json:"mode"`
+	RunID    int64     `json:"run_id"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+func (c *StatusCommand) ExecuteContext(ctx context.Context, args []string) error {
+	db, err := c.Postgres.openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report := &statusReport{orgs: make(map[string]*orgStatus)}
+	for _, o := range c.Orgs {
+		report.org(o)
+	}
+
+	if err := c.migrationVersion(report); err != nil {
+		return err
+	}
+
+	loaders := []func(*sql.DB, *statusReport) error{
+		c.entityCounts,
+		c.shallowStatus,
+		c.deepStatus,
+		c.repositorySyncs,
+	}
+
+	for _, load := range loaders {
+		if err := load(db, report); err != nil {
+			return err
+		}
+	}
+
+	if c.Token != "" {
+		c.rateLimits(ctx, report)
+	}
+
+	sort.Slice(report.Orgs, func(i, j int) bool {
+		return report.Orgs[i].Org < report.Orgs[j].Org
+	})
+
+	if c.Format == "json" {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(report)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	writeStatus(w, report, time.Now())
+	return w.Flush()
+}
+
+// org returns the status of an organization, adding it to the report if it
+// wasn't there.
+func (r *statusReport) org(name string) *orgStatus {
+	if o, ok := r.orgs[name]; ok {
+		return o
+	}
+
+	o := &orgStatus{Org: name, Entities: make(map[string]int64)}
+	r.orgs[name] = o
+	r.Orgs = append(r.Orgs, o)
+	return o
+}
+
+func (c *StatusCommand) migrationVersion(report *statusReport) error {
+	m, err := newMigrate(c.Postgres.URL())
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	version, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return err
+	}
+
+	report.MigrationVersion = version
+	report.MigrationDirty = dirty
+	return nil
+}
+
+func (c *StatusCommand) entityCounts(db *sql.DB, report *statusReport) error {
+	for _, t := range entityTables {
+		rows, err := c.query(db, t.Table, t.Owner, fmt.Sprintf("%s, count(*)", t.Owner),
+			"GROUP BY "+t.Owner)
+		if err != nil {
+			return err
+		}
+
+		if rows == nil {
+			continue
+		}
+
+		for rows.Next() {
+			var org string
+			var count int64
+			if err := rows.Scan(&org, &count); err != nil {
+				rows.Close()
+				return err
+			}
+
+			report.org(org).Entities[t.Table] = count
+		}
+
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *StatusCommand) shallowStatus(db *sql.DB, report *statusReport) error {
+	rows, err := c.query(db, statusTableName, "org",
+		"org, entity, done, failed, total", "ORDER BY entity")
+	if rows == nil || err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var org string
+		var total sql.NullInt64
+		s := &shallowStatus{}
+		if err := rows.Scan(&org, &s.Entity, &s.Done, &s.Failed, &total); err != nil {
+			return err
+		}
+
+		if total.Valid {
+			s.Total = &total.Int64
+		}
+
+		o := report.org(org)
+		o.Shallow = append(o.Shallow, s)
+	}
+
+	return rows.Err()
+}
+
+func (c *StatusCommand) deepStatus(db *sql.DB, report *statusReport) error {
+	rows, err := c.query(db, progressTableName, "org",
+		"org, task, published, done, failed, started_at, updated_at", "ORDER BY task")
+	if rows == nil || err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var org string
+		s := &deepStatus{}
+		if err := rows.Scan(&org, &s.Task, &s.Published, &s.Done, &s.Failed,
+			&s.StartedAt, &s.UpdatedAt); err != nil {
+			return err
+		}
+
+		o := report.org(org)
+		o.Deep = append(o.Deep, s)
+	}
+
+	return rows.Err()
+}
+
+func (c *StatusCommand) repositorySyncs(db *sql.DB, report *statusReport) error {
+	rows, err := c.query(db, repositorySyncsTableName, "owner",
+		"owner, name, mode, run_id, synced_at", "ORDER BY name")
+	if rows == nil || err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var owner string
+		s := &repositorySync{}
+		if err := rows.Scan(&owner, &s.Name, &s.Mode, &s.RunID, &s.SyncedAt); err != nil {
+			return err
+		}
+
+		o := report.org(owner)
+		o.Repositories = append(o.Repositories, s)
+	}
+
+	return rows.Err()
+}
+
+// query selects the columns of the rows of the requested organizations,
+// stored in the org column. No rows are returned if the table doesn't exist
+// yet.
+func (c *StatusCommand) query(db *sql.DB, table, org, columns, suffix string) (*sql.Rows, error) {
+	var exists bool
+	if err := db.QueryRow("SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	stm := fmt.Sprintf("SELECT %s FROM %s", columns, table)
+	var params []interface{}
+	if len(c.Orgs) != 0 {
+		stm += fmt.Sprintf(" WHERE %s = ANY($1)", org)
+		params = append(params, pq.Array(c.Orgs))
+	}
+
+	return db.Query(stm+" "+suffix, params...)
+}
+
+// rateLimits adds the rate limit budget of each token to the report. The
+// errors are reported instead of returned, the rest of the status is still
+// useful without them.
+func (c *StatusCommand) rateLimits(ctx context.Context, report *statusReport) {
+	for _, token := range strings.Split(c.Token, ",") {
+		if token = strings.TrimSpace(token); token == "" {
+			continue
+		}
+
+		rate := &tokenRate{Token: utils.MaskToken(token)}
+		report.RateLimits = append(report.RateLimits, rate)
+
+		client, err := c.GitHub.newClient(token, nil)
+		if err != nil {
+			rate.Error = err.Error()
+			continue
+		}
+
+		limits, _, err := client.RateLimits(ctx)
+		if err != nil {
+			log.Errorf(err, "unable to get the rate limit of token %s", rate.Token)
+			rate.Error = err.Error()
+			continue
+		}
+
+		rate.Limit = limits.GetCore().Limit
+		rate.Remaining = limits.GetCore().Remaining
+		rate.Reset = limits.GetCore().Reset.Time
+	}
+}
+
+func writeStatus(w io.Writer, report *statusReport, now time.Time) {
+	dirty := ""
+	if report.MigrationDirty {
+		dirty = " (dirty)"
+	}
+
+	fmt.Fprintf(w, "DB version:\t%d%s\n", report.MigrationVersion, dirty)
+	for _, r := range report.RateLimits {
+		if r.Error != "" {
+			fmt.Fprintf(w, "rate limit of %s:\terror: %s\n", r.Token, r.Error)
+			continue
+		}
+
+		fmt.Fprintf(w, "rate limit of %s:\t%d/%d, reset in %s\n", r.Token, r.Remaining, r.Limit,
+			r.Reset.Sub(now).Round(time.Second))
+	}
+
+	if len(report.Orgs) == 0 {
+		fmt.Fprintf(w, "\nno organizations found\n")
+	}
+
+	for _, o := range report.Orgs {
+		fmt.Fprintf(w, "\n%s\n", strings.ToUpper(o.Org))
+		writeEntityCounts(w, o.Entities)
+		writeShallowStatus(w, o.Shallow)
+		writeDeepStatus(w, o.Deep, now)
+		writeRepositorySyncs(w, o.Repositories, now)
+	}
+}
+
+func writeEntityCounts(w io.Writer, entities map[string]int64) {
+	for _, t := range entityTables {
+		fmt.Fprintf(w, "%s:\t%d\n", t.Table, entities[t.Table])
+	}
+}
+
+func writeShallowStatus(w io.Writer, status []*shallowStatus) {
+	if len(status) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nSHALLOW\tPROGRESS\tDONE\tFAILED\n")
+	for _, s := range status {
+		total := "?"
+		progress := "waiting"
+		if s.Total != nil {
+			total = fmt.Sprint(*s.Total)
+			progress = progressBar(s.Done+s.Failed, int(*s.Total))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d/%s\t%d\n", s.Entity, progress, s.Done, total, s.Failed)
+	}
+}
+
+func writeDeepStatus(w io.Writer, status []*deepStatus, now time.Time) {
+	if len(status) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nDEEP\tPROGRESS\tDONE\tFAILED\tETA\n")
+	for _, s := range status {
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%d\t%s\n",
+			s.Task, progressBar(s.Done+s.Failed, s.Published),
+			s.Done, s.Published, s.Failed, s.eta(now))
+	}
+}
+
+func writeRepositorySyncs(w io.Writer, syncs []*repositorySync, now time.Time) {
+	if len(syncs) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nREPOSITORY\tLAST SYNC\tMODE\tRUN\n")
+	for _, s := range syncs {
+		fmt.Fprintf(w, "%s\t%s ago\t%s\t%d\n",
+			s.Name, now.Sub(s.SyncedAt).Round(time.Second), s.Mode, s.RunID)
+	}
+}
+
+// eta estimates the time left to handle all the published jobs, from the
+// rate they were handled so far.
+func (s *deepStatus) eta(now time.Time) string {
+	handled := s.Done + s.Failed
+	pending := s.Published - handled
+	if pending <= 0 {
+		return "done"
+	}
+
+	if handled == 0 {
+		return "-"
+	}
+
+	elapsed := s.UpdatedAt.Sub(s.StartedAt)
+	eta := elapsed / time.Duration(handled) * time.Duration(pending)
+	// the time since the last update is already part of the estimation
+	eta -= now.Sub(s.UpdatedAt)
+	if eta < 0 {
+		eta = 0
+	}
+
+	return eta.Round(time.Second).String()
+}
+
+// progressBar renders the progress of n out of total as a text bar.
+func progressBar(n, total int) string {
+	ratio := 1.0
+	if total > 0 {
+		ratio = float64(n) / float64(total)
+	}
+
+	if ratio > 1 {
+		ratio = 1
+	}
+
+	filled := int(ratio * progressBarWidth)
+	return fmt.Sprintf("[%s%s] %3.0f%%",
+		strings.Repeat("#", filled),
+		strings.Repeat("-", progressBarWidth-filled),
+		ratio*100)
+}
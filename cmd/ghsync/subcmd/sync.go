@@ -0,0 +1,241 @@
+package subcmd
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/src-d/ghsync/deep"
+	"github.com/src-d/ghsync/shallow"
+	"github.com/src-d/ghsync/utils"
+
+	"gopkg.in/src-d/go-cli.v0"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+type SyncCommand struct {
+	cli.Command `name:"sync" short-description:"Sync of the targets defined in a config file" long-description:"Sync of the organizations, users and repositories defined as targets in a YAML or TOML config file. Shallow targets are synced, deep targets publish their jobs to be handled by the deep workers"`
+
+	Config  string   `long:"config" env:"GHSYNC_CONFIG" description:"YAML or TOML config file" required:"true"`
+	Targets []string `long:"target" description:"Name of a target to sync. All of them are synced if it's not given"`
+
+	QueueOpt QueueOpt    `group:"go-queue connection options"`
+	Report   ReportOpt   `group:"Report options"`
+	Metrics  MetricsOpt  `group:"Metrics options"`
+	Tracing  TracingOpt  `group:"Tracing options"`
+	GitHub   GitHubOpt   `group:"GitHub Enterprise options"`
+	Postgres PostgresOpt `group:"PostgreSQL connection options"`
+}
+
+func (c *SyncCommand) ExecuteContext(ctx context.Context, args []string) error {
+	cfg := &Config{
+		GitHub:   c.GitHub,
+		Postgres: c.Postgres,
+		Queue:    c.QueueOpt,
+	}
+
+	if err := loadConfig(c.Config, cfg); err != nil {
+		return err
+	}
+
+	targets := cfg.Targets
+	if len(c.Targets) != 0 {
+		targets = nil
+		for _, name := range c.Targets {
+			t, err := cfg.target(name)
+			if err != nil {
+				return err
+			}
+
+			targets = append(targets, t)
+		}
+	}
+
+	if err := c.Metrics.serve(); err != nil {
+		return err
+	}
+
+	shutdown, err := c.Tracing.start()
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
+	db, err := cfg.Postgres.initDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var runs []*run
+	for _, t := range targets {
+		r, err := runRecordedTarget(ctx, db, cfg, t)
+		if r != nil {
+			runs = append(runs, r)
+		}
+
+		if err != nil {
+			c.Report.print(runs...)
+			return err
+		}
+	}
+
+	c.Report.print(runs...)
+	return nil
+}
+
+// runRecordedTarget runs a target recording the run. The run is skipped if
+// any of its organizations or users is still being synced by another run,
+// like the previous run of the target.
+func runRecordedTarget(ctx context.Context, db *sql.DB, cfg *Config, t *Target) (*run, error) {
+	logger := log.New(log.Fields{"target": t.Name, "mode": t.Mode})
+
+	r, err := startRun(db, t.Name, t.Mode, t.targets())
+	if err != nil {
+		return nil, err
+	}
+
+	lock, busy, err := tryLockOwners(ctx, db, t.lockedOwners())
+	if err != nil {
+		if err := r.finish(err); err != nil {
+			logger.Errorf(err, "unable to finish the run")
+		}
+
+		return r, fmt.Errorf("unable to acquire the lock of %s: %v", busy, err)
+	}
+
+	if lock == nil {
+		logger.With(log.Fields{"owner": busy}).Warningf("another run still in progress, skipping")
+		return r, r.skip()
+	}
+
+	defer func() {
+		if err := lock.Unlock(); err != nil {
+			logger.Errorf(err, "unable to release the owner locks")
+		}
+	}()
+
+	err = runTarget(ctx, db, cfg, t, r)
+	if err := r.finish(err); err != nil {
+		logger.Errorf(err, "unable to finish the run")
+	}
+
+	return r, err
+}
+
+// runTarget syncs a config target in the run r. Deep targets only publish
+// their jobs.
+func runTarget(ctx context.Context, db *sql.DB, cfg *Config, t *Target, r *run) error {
+	logger := log.New(log.Fields{"target": t.Name, "mode": t.Mode})
+	logger.Infof("starting to sync target")
+
+	var err error
+	if t.Mode == deepMode {
+		err = enqueueTarget(ctx, db, cfg, t)
+	} else {
+		err = syncShallowTarget(ctx, db, cfg, t, r, logger)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("finished to sync target")
+	return nil
+}
+
+func syncShallowTarget(ctx context.Context, db *sql.DB, cfg *Config, t *Target, r *run, logger log.Logger) error {
+	stats := r.Stats
+	client, err := cfg.GitHub.newClient(t.token(cfg), stats)
+	if err != nil {
+		return err
+	}
+
+	filter, err := t.Filter.filter()
+	if err != nil {
+		return err
+	}
+
+	entities, err := utils.ParseEntities(t.Entities)
+	if err != nil {
+		return err
+	}
+
+	failures := shallow.NewFailures(db, failureTableName, r.ID, shallow.OnError(t.OnError))
+	if owners := t.owners(); len(owners) != 0 {
+		if err := syncShallow(ctx, db, client, filter, entities, stats, failures, t.parallelism(), owners); err != nil {
+			return err
+		}
+	}
+
+	cursors := shallow.NewCursors(db, cursorTableName)
+	repoSyncer := shallow.NewRepositorySyncer(db, client, statusTableName,
+		cursors, failures, nil, entities, t.parallelism(), stats)
+	err = utils.RunParallel(ctx, t.parallelism(), len(t.Repos), func(ctx context.Context, i int) error {
+		owner, name, _ := splitRepositoryName(t.Repos[i])
+		if err := repoSyncer.SyncRepository(ctx, owner, name, logger.With(log.Fields{"owner": owner})); err != nil {
+			return failures.Handle(ctx, owner, utils.RepositoryEntity, t.Repos[i], err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return failures.Err()
+}
+
+// enqueueTarget publishes the deep jobs of a target, with its entities and
+// repository filter. If no queue name is configured, the jobs are published
+// to the queue named after the first organization, user or repository owner
+// of the target.
+func enqueueTarget(ctx context.Context, db *sql.DB, cfg *Config, t *Target) error {
+	defaultQueue := ""
+	if owners := t.owners(); len(owners) != 0 {
+		defaultQueue = owners[0]
+	} else {
+		defaultQueue, _, _ = splitRepositoryName(t.Repos[0])
+	}
+
+	q, err := cfg.Queue.openQueue(defaultQueue)
+	if err != nil {
+		return err
+	}
+
+	dedup, err := cfg.Queue.dedup(db)
+	if err != nil {
+		return err
+	}
+
+	ctx, err = cfg.Queue.withLane(ctx, deep.NormalLane)
+	if err != nil {
+		return err
+	}
+
+	// the organizations are synced by the workers, with the entities and
+	// filter of the target instead of their own
+	ctx = deep.WithOptions(ctx, deep.JobOptions{
+		Entities: t.Entities,
+		Filter:   t.Filter.options(),
+	})
+
+	syncer := deep.NewSyncer(db, nil, q, nil)
+	syncer.Progress = deep.NewProgress(db, progressTableName)
+	syncer.Dedup = dedup
+
+	for _, o := range t.owners() {
+		if err := syncer.QueueOrganization(ctx, o); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range t.Repos {
+		owner, name, _ := splitRepositoryName(r)
+		if err := syncer.QueueRepository(ctx, owner, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
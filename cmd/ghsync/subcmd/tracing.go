@@ -0,0 +1,86 @@
+package subcmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+type TracingOpt struct {
+	Exporter string `long:"tracing-exporter" env:"GHSYNC_TRACING_EXPORTER" choice:"none" choice:"otlp" choice:"stdout" choice:"file" default:"none" description:"Exporter of the OpenTelemetry traces"`
+	Endpoint string `long:"tracing-endpoint" env:"GHSYNC_TRACING_ENDPOINT" default:"localhost:4318" description:"host:port of the OTLP/HTTP collector, for the otlp exporter"`
+	Insecure bool   `long:"tracing-insecure" env:"GHSYNC_TRACING_INSECURE" description:"Use plain HTTP to send the traces to the OTLP collector"`
+	File     string `long:"tracing-file" env:"GHSYNC_TRACING_FILE" default:"ghsync-traces.json" description:"File where the traces are written as JSON, for the file exporter"`
+}
+
+// start sets the global TracerProvider and propagator. The returned function
+// flushes the pending spans, it must be called before the process exits.
+func (o TracingOpt) start() (shutdown func(), err error) {
+	if o.Exporter == "" || o.Exporter == "none" {
+		return func() {}, nil
+	}
+
+	var (
+		exporter sdktrace.SpanExporter
+		closer   io.Closer
+	)
+
+	switch o.Exporter {
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(o.Endpoint)}
+		if o.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	case "file":
+		var f *os.File
+		f, err = os.Create(o.File)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create the traces file: %v", err)
+		}
+
+		closer = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", o.Exporter)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the %s tracing exporter: %v", o.Exporter, err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "ghsync"),
+		)),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	log.With(log.Fields{"exporter": o.Exporter}).Infof("tracing enabled")
+
+	return func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			log.Errorf(err, "unable to flush the traces")
+		}
+
+		if closer != nil {
+			closer.Close()
+		}
+	}, nil
+}
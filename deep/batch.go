@@ -0,0 +1,67 @@
+package deep
+
+import (
+	"context"
+
+	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
+
+	"gopkg.in/src-d/go-kallax.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// upsert writes the records of a listing page in the batch with a single
+// statement, instead of a find followed by an insert or an update for each
+// one, and records them in the stats.
+func upsert(ctx context.Context, store *kallax.Store, batch *models.Batch, e utils.Entity, stats *utils.Stats) error {
+	n := batch.Len()
+	if n == 0 {
+		return nil
+	}
+
+	end := utils.StartStoreOp(ctx, "upsert", e)
+	inserted, updated, err := batch.Upsert(store)
+	end(err)
+	if err != nil {
+		stats.RecordN(e, utils.Failed, n, err)
+		return err
+	}
+
+	stats.RecordN(e, utils.Inserted, inserted, nil)
+	stats.RecordN(e, utils.Updated, updated, nil)
+	return nil
+}
+
+// upsertOrEach is like upsert, but if the statement fails the records are
+// written one by one, so a bad record is the only one failing, logged and
+// skipped, as when each record was written on its own.
+func upsertOrEach(
+	ctx context.Context,
+	store *kallax.Store,
+	batch *models.Batch,
+	e utils.Entity,
+	stats *utils.Stats,
+	logger log.Logger,
+) {
+	n := batch.Len()
+	if n == 0 {
+		return
+	}
+
+	end := utils.StartStoreOp(ctx, "upsert", e)
+	inserted, updated, err := batch.Upsert(store)
+	end(err)
+	if err != nil {
+		logger.Errorf(err, "batch write failed, writing the %s one by one", e)
+
+		end := utils.StartStoreOp(ctx, "upsert", e)
+		inserted, updated = batch.UpsertEach(store, func(r kallax.Record, err error) {
+			stats.Record(e, utils.Failed, err)
+			logger.With(log.Fields{"id": r.GetID().Raw()}).Errorf(err, "%s sync error", e)
+		})
+		end(nil)
+	}
+
+	stats.RecordN(e, utils.Inserted, inserted, nil)
+	stats.RecordN(e, utils.Updated, updated, nil)
+}
@@ -1,8 +1,11 @@
 package deep
 
 import (
-	"strings"
+	"context"
+	"fmt"
+	"time"
 
+	"go.opentelemetry.io/otel/propagation"
 	"gopkg.in/src-d/go-log.v1"
 	"gopkg.in/src-d/go-queue.v1"
 )
@@ -10,6 +13,7 @@ import (
 type SyncTaskType string
 
 const (
+	OrganizationSyncTask       SyncTaskType = "organization"
 	RepositorySyncTask         SyncTaskType = "repository"
 	UserSyncTask               SyncTaskType = "user"
 	IssueSyncTask              SyncTaskType = "issue"
@@ -18,23 +22,76 @@ const (
 	PullRequestCommentSyncTask SyncTaskType = "pull-request-comment"
 	PullRequestReviewSyncTask  SyncTaskType = "pull-request-review"
 
+	IssueCommentPageSyncTask       SyncTaskType = "issue-comment-page"
+	PullRequestCommentPageSyncTask SyncTaskType = "pull-request-comment-page"
+
 	listOptionsPerPage = 100
+
+	// userOwnerType is the type of the owners that are user accounts instead
+	// of organizations
+	userOwnerType = "User"
 )
 
 type SyncTasks struct {
-	Type    SyncTaskType
+	Type SyncTaskType
+	// Version is the version of the payload format, the jobs published before
+	// it was added have version 0, with the same format as the version 1
+	Version int
 	Payload interface{}
+	// Key is the idempotency key of the job, used to skip duplicated jobs
+	Key string
+	// Trace is the trace context of the span that published the job, so the
+	// job is traced as its child
+	Trace map[string]string
+	// Options are the options the job was requested with, they replace the
+	// ones of the worker handling it
+	Options JobOptions
 }
 
-func newSyncTasks(t SyncTaskType, payload interface{}) (*queue.Job, error) {
+// traceContext propagates the trace context in the jobs, using the W3C
+// Trace Context format.
+var traceContext = propagation.TraceContext{}
+
+// newSyncTasks returns a job of the task type, in the lane and with the
+// options of ctx. updatedAt is when the target of the job was last updated,
+// it's part of the idempotency key if it's known.
+func newSyncTasks(ctx context.Context, t SyncTaskType, payload Payload, updatedAt time.Time) (*queue.Job, error) {
+	if err := payload.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s job: %v", t, err)
+	}
+
+	opts := optionsFromContext(ctx)
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s job: %v", t, err)
+	}
+
+	// the workers of the version 1 would ignore the options, so it's only
+	// used for the jobs without them
+	version := PayloadVersion
+	key := jobKey(t, payload, updatedAt)
+	if opts.IsZero() {
+		version = 1
+	} else {
+		key += " " + opts.key()
+	}
+
 	j, err := queue.NewJob()
 	if err != nil {
 		return nil, err
 	}
 
+	j.SetPriority(lanePriorities[laneFromContext(ctx)])
+
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+
 	err = j.Encode(&SyncTasks{
 		Type:    t,
+		Version: version,
 		Payload: payload,
+		Key:     key,
+		Trace:   carrier,
+		Options: opts,
 	})
 
 	if err != nil {
@@ -44,21 +101,74 @@ func newSyncTasks(t SyncTaskType, payload interface{}) (*queue.Job, error) {
 	return j, nil
 }
 
+// context returns a context with the trace context of the span that
+// published the job.
+func (t *SyncTasks) context(ctx context.Context) context.Context {
+	return traceContext.Extract(ctx, propagation.MapCarrier(t.Trace))
+}
+
+type OrganizationSyncPayload struct {
+	Org string
+}
+
+func (p *OrganizationSyncPayload) Validate() error {
+	if p.Org == "" {
+		return fmt.Errorf("missing org")
+	}
+
+	return nil
+}
+
+func (p *OrganizationSyncPayload) Fields() log.Fields {
+	return log.Fields{"org": p.Org}
+}
+
+// NewOrganizationSyncJob returns the job of an organization or user account,
+// the worker handling it publishes the jobs of its repositories and members.
+func NewOrganizationSyncJob(ctx context.Context, org string) (*queue.Job, error) {
+	return newSyncTasks(ctx, OrganizationSyncTask, &OrganizationSyncPayload{org}, time.Time{})
+}
+
 type RepositorySyncPayload struct {
 	Owner string
 	Name  string
 }
 
-func NewRepositorySyncJob(owner, name string) (*queue.Job, error) {
-	return newSyncTasks(RepositorySyncTask, RepositorySyncPayload{owner, name})
+func (p *RepositorySyncPayload) Validate() error {
+	return validateRepository(p.Owner, p.Name)
+}
+
+func (p *RepositorySyncPayload) Fields() log.Fields {
+	return log.Fields{"owner": p.Owner, "name": p.Name}
+}
+
+// NewRepositorySyncJob returns the job of a repository, updatedAt is when it
+// was last updated, zero if it's unknown.
+func NewRepositorySyncJob(ctx context.Context, owner, name string, updatedAt time.Time) (*queue.Job, error) {
+	return newSyncTasks(ctx, RepositorySyncTask, &RepositorySyncPayload{owner, name}, updatedAt)
 }
 
 type UserSyncPayload struct {
 	Login string
+	// Org is the organization the user was published for, used to track
+	// the progress
+	Org string
+}
+
+func (p *UserSyncPayload) Validate() error {
+	if p.Login == "" {
+		return fmt.Errorf("missing login")
+	}
+
+	return nil
+}
+
+func (p *UserSyncPayload) Fields() log.Fields {
+	return log.Fields{"login": p.Login, "org": p.Org}
 }
 
-func NewUserSyncJob(login string) (*queue.Job, error) {
-	return newSyncTasks(UserSyncTask, UserSyncPayload{login})
+func NewUserSyncJob(ctx context.Context, org, login string) (*queue.Job, error) {
+	return newSyncTasks(ctx, UserSyncTask, &UserSyncPayload{login, org}, time.Time{})
 }
 
 type IssueSyncPayload struct {
@@ -67,12 +177,28 @@ type IssueSyncPayload struct {
 	Number uint64
 }
 
-func NewIssueSyncJob(owner, name string, number int) (*queue.Job, error) {
-	return newSyncTasks(IssueSyncTask, IssueSyncPayload{owner, name, uint64(number)})
+func (p *IssueSyncPayload) Validate() error {
+	if p.Number == 0 {
+		return fmt.Errorf("missing number")
+	}
+
+	return validateRepository(p.Owner, p.Name)
+}
+
+func (p *IssueSyncPayload) Fields() log.Fields {
+	return log.Fields{"owner": p.Owner, "name": p.Name, "number": p.Number}
 }
 
-func NewPullRequestSyncJob(owner, name string, number int) (*queue.Job, error) {
-	return newSyncTasks(PullRequestSyncTask, IssueSyncPayload{owner, name, uint64(number)})
+// NewIssueSyncJob returns the job of an issue, updatedAt is when it was last
+// updated, zero if it's unknown.
+func NewIssueSyncJob(ctx context.Context, owner, name string, number int, updatedAt time.Time) (*queue.Job, error) {
+	return newSyncTasks(ctx, IssueSyncTask, &IssueSyncPayload{owner, name, uint64(number)}, updatedAt)
+}
+
+// NewPullRequestSyncJob returns the job of a pull request, updatedAt is when
+// it was last updated, zero if it's unknown.
+func NewPullRequestSyncJob(ctx context.Context, owner, name string, number int, updatedAt time.Time) (*queue.Job, error) {
+	return newSyncTasks(ctx, PullRequestSyncTask, &IssueSyncPayload{owner, name, uint64(number)}, updatedAt)
 }
 
 type IssueCommentSyncPayload struct {
@@ -81,12 +207,57 @@ type IssueCommentSyncPayload struct {
 	CommentID uint64
 }
 
-func NewIssueCommentSyncJob(owner, name string, id int64) (*queue.Job, error) {
-	return newSyncTasks(IssueCommentSyncTask, IssueCommentSyncPayload{owner, name, uint64(id)})
+func (p *IssueCommentSyncPayload) Validate() error {
+	if p.CommentID == 0 {
+		return fmt.Errorf("missing comment ID")
+	}
+
+	return validateRepository(p.Owner, p.Name)
+}
+
+func (p *IssueCommentSyncPayload) Fields() log.Fields {
+	return log.Fields{"owner": p.Owner, "name": p.Name, "commentid": p.CommentID}
+}
+
+func NewIssueCommentSyncJob(ctx context.Context, owner, name string, id int64) (*queue.Job, error) {
+	return newSyncTasks(ctx, IssueCommentSyncTask, &IssueCommentSyncPayload{owner, name, uint64(id)}, time.Time{})
+}
+
+func NewPullRequestCommentSyncJob(ctx context.Context, owner, name string, id int64) (*queue.Job, error) {
+	return newSyncTasks(ctx, PullRequestCommentSyncTask, &IssueCommentSyncPayload{owner, name, uint64(id)}, time.Time{})
+}
+
+// CommentPageSyncPayload is a page of the comments of a repository. The jobs
+// of the first page publish the jobs of the rest of pages, so they are
+// handled in parallel, and the jobs of the last page follow the pages added
+// since.
+type CommentPageSyncPayload struct {
+	Owner string
+	Name  string
+	Page  uint64
+	Last  bool
+}
+
+func (p *CommentPageSyncPayload) Validate() error {
+	if p.Page == 0 {
+		return fmt.Errorf("missing page")
+	}
+
+	return validateRepository(p.Owner, p.Name)
+}
+
+func (p *CommentPageSyncPayload) Fields() log.Fields {
+	return log.Fields{"owner": p.Owner, "name": p.Name, "page": p.Page}
 }
 
-func NewPullRequestCommentSyncJob(owner, name string, id int64) (*queue.Job, error) {
-	return newSyncTasks(PullRequestCommentSyncTask, IssueCommentSyncPayload{owner, name, uint64(id)})
+func NewIssueCommentPageSyncJob(ctx context.Context, owner, name string, page int, last bool) (*queue.Job, error) {
+	return newSyncTasks(ctx, IssueCommentPageSyncTask,
+		&CommentPageSyncPayload{owner, name, uint64(page), last}, time.Time{})
+}
+
+func NewPullRequestCommentPageSyncJob(ctx context.Context, owner, name string, page int, last bool) (*queue.Job, error) {
+	return newSyncTasks(ctx, PullRequestCommentPageSyncTask,
+		&CommentPageSyncPayload{owner, name, uint64(page), last}, time.Time{})
 }
 
 type PullRequestReviewSyncPayload struct {
@@ -96,45 +267,23 @@ type PullRequestReviewSyncPayload struct {
 	ReviewID uint64
 }
 
-func NewPullRequestReviewSyncJob(owner, name string, number int, id int64) (*queue.Job, error) {
-	return newSyncTasks(PullRequestReviewSyncTask,
-		PullRequestReviewSyncPayload{owner, name, uint64(number), uint64(id)})
-}
-
-func logFieldsFromPayload(payload map[interface{}]interface{}) log.Fields {
-	fields := make(log.Fields, len(payload))
-	for k, v := range payload {
-		fields[strings.ToLower(k.(string))] = v
+func (p *PullRequestReviewSyncPayload) Validate() error {
+	if p.Number == 0 {
+		return fmt.Errorf("missing number")
 	}
 
-	return fields
-}
-
-func toInt(v interface{}) int {
-	switch n := v.(type) {
-	case int64:
-		return int(n)
-	case uint64:
-		return int(n)
-	case int32:
-		return int(n)
-	case uint32:
-		return int(n)
-	case int8:
-		return int(n)
-	case uint8:
-		return int(n)
-	case int16:
-		return int(n)
-	case uint16:
-		return int(n)
-	case uint:
-		return int(n)
-	case int:
-		return n
-	case float64:
-		return int(n)
+	if p.ReviewID == 0 {
+		return fmt.Errorf("missing review ID")
 	}
 
-	return 0
+	return validateRepository(p.Owner, p.Name)
+}
+
+func (p *PullRequestReviewSyncPayload) Fields() log.Fields {
+	return log.Fields{"owner": p.Owner, "name": p.Name, "number": p.Number, "reviewid": p.ReviewID}
+}
+
+func NewPullRequestReviewSyncJob(ctx context.Context, owner, name string, number int, id int64) (*queue.Job, error) {
+	return newSyncTasks(ctx, PullRequestReviewSyncTask,
+		&PullRequestReviewSyncPayload{owner, name, uint64(number), uint64(id)}, time.Time{})
 }
@@ -0,0 +1,231 @@
+package deep
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-log.v1"
+	"gopkg.in/src-d/go-queue.v1"
+)
+
+// pendingTTL is how long a job published but not handled yet is considered
+// pending, in case it's lost without being handled.
+const pendingTTL = 24 * time.Hour
+
+// errDuplicatedJob is returned by dedupQueue when a job is not published
+// because it's a duplicate of a job pending or handled recently.
+var errDuplicatedJob = errors.New("job already pending or handled recently")
+
+// Dedup skips the jobs already pending or handled recently, tracking the
+// idempotency key of each job in a table. All its methods can be called on a
+// nil Dedup, that doesn't skip anything.
+type Dedup struct {
+	db        *sql.DB
+	tableName string
+
+	// TTL is how long a job handled is considered recent, per task type. The
+	// task types not present use DefaultTTL, a zero TTL disables the
+	// deduplication of the task type
+	TTL map[SyncTaskType]time.Duration
+	// DefaultTTL is the TTL of the task types not present in TTL
+	DefaultTTL time.Duration
+}
+
+// NewDedup returns a Dedup that tracks the jobs in the given table, as
+// created by CreateDedupTable.
+func NewDedup(db *sql.DB, tableName string, defaultTTL time.Duration) *Dedup {
+	return &Dedup{
+		db:         db,
+		tableName:  tableName,
+		TTL:        make(map[SyncTaskType]time.Duration),
+		DefaultTTL: defaultTTL,
+	}
+}
+
+// CreateDedupTable creates the dedup table if it doesn't exist.
+func CreateDedupTable(db *sql.DB, tableName string) error {
+	stm := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+    key TEXT PRIMARY KEY,
+    task VARCHAR (30) NOT NULL,
+    state VARCHAR (10) NOT NULL,
+    published_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    handled_at TIMESTAMP WITH TIME ZONE
+);`, tableName)
+	log.Debugf("running statement: %s", stm)
+	if _, err := db.Exec(stm); err != nil {
+		return fmt.Errorf("an error occured while ensuring the %s table: %v", tableName, err)
+	}
+
+	return nil
+}
+
+// ParseTTL parses the TTLs of the task types. Each value can be just a
+// duration, applied to all the task types, or a task:duration pair, e.g.
+// "issue:6h".
+func (d *Dedup) ParseTTL(values []string) error {
+	for _, item := range values {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		var task SyncTaskType
+		value := item
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) == 2 {
+			task = SyncTaskType(parts[0])
+			if _, ok := payloads[task]; !ok {
+				return fmt.Errorf("unknown task type %q", parts[0])
+			}
+
+			value = parts[1]
+		}
+
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid TTL %q: %v", item, err)
+		}
+
+		if task == "" {
+			d.DefaultTTL = ttl
+			continue
+		}
+
+		d.TTL[task] = ttl
+	}
+
+	return nil
+}
+
+func (d *Dedup) ttl(t SyncTaskType) time.Duration {
+	if ttl, ok := d.TTL[t]; ok {
+		return ttl
+	}
+
+	return d.DefaultTTL
+}
+
+// Claim records a job as pending before publishing it. It returns false if
+// the job is a duplicate: it's still pending or it was handled within the
+// TTL of its task type.
+func (d *Dedup) Claim(t SyncTaskType, key string) (bool, error) {
+	if d == nil || key == "" {
+		return true, nil
+	}
+
+	ttl := d.ttl(t)
+	if ttl <= 0 {
+		return true, nil
+	}
+
+	stm := fmt.Sprintf(`INSERT INTO %[1]s (key, task, state, published_at) VALUES ($1, $2, 'pending', now())
+ON CONFLICT (key) DO UPDATE SET state='pending', published_at=now(), handled_at=NULL
+WHERE (%[1]s.state='done' AND %[1]s.handled_at < now() - make_interval(secs => $3))
+OR (%[1]s.state='pending' AND %[1]s.published_at < now() - make_interval(secs => $4))
+RETURNING key`, d.tableName)
+
+	var claimed string
+	err := d.db.QueryRow(stm, key, string(t), ttl.Seconds(), pendingTTL.Seconds()).Scan(&claimed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("an error occured while updating %s table: %v", d.tableName, err)
+	}
+
+	return true, nil
+}
+
+// Handled records a job as handled. The failed jobs are forgotten, so they
+// can be published again right away.
+func (d *Dedup) Handled(key string, err error) error {
+	if d == nil || key == "" {
+		return nil
+	}
+
+	stm := fmt.Sprintf("UPDATE %s SET state='done', handled_at=now() WHERE key=$1", d.tableName)
+	if err != nil {
+		stm = fmt.Sprintf("DELETE FROM %s WHERE key=$1", d.tableName)
+	}
+
+	if _, err := d.db.Exec(stm, key); err != nil {
+		return fmt.Errorf("an error occured while updating %s table: %v", d.tableName, err)
+	}
+
+	return nil
+}
+
+// jobKey returns the idempotency key of a job: its task type, the target of
+// its payload and, if it's known, when the target was last updated, so a
+// target updated after its job was handled is synced again.
+func jobKey(t SyncTaskType, p Payload, updatedAt time.Time) string {
+	fields := p.Fields()
+	names := make([]string, 0, len(fields))
+	for k := range fields {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	parts := []string{string(t)}
+	for _, k := range names {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, fields[k]))
+	}
+
+	if !updatedAt.IsZero() {
+		parts = append(parts, "updated_at="+updatedAt.UTC().Format(time.RFC3339))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// dedupQueue is a queue that doesn't publish the duplicated jobs, returning
+// errDuplicatedJob instead.
+type dedupQueue struct {
+	queue.Queue
+	d *Dedup
+}
+
+func (q *dedupQueue) Publish(j *queue.Job) error {
+	var task *SyncTasks
+	if err := j.Decode(&task); err != nil {
+		return err
+	}
+
+	ok, err := q.d.Claim(task.Type, task.Key)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		log.With(log.Fields{"key": task.Key}).Debugf("duplicated job, skipping")
+		jobsDeduplicated.WithLabelValues(string(task.Type)).Inc()
+		return errDuplicatedJob
+	}
+
+	if err := q.Queue.Publish(j); err != nil {
+		if err := q.d.Handled(task.Key, err); err != nil {
+			log.Errorf(err, "unable to release the job key")
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// publish publishes a job, it returns false if it was skipped because it's
+// duplicated.
+func publish(q queue.Queue, j *queue.Job) (bool, error) {
+	err := q.Publish(j)
+	if err == errDuplicatedJob {
+		return false, nil
+	}
+
+	return err == nil, err
+}
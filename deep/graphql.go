@@ -0,0 +1,303 @@
+package deep
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// API is the GitHub API used to retrieve an entity.
+type API string
+
+const (
+	RESTAPI    API = "rest"
+	GraphQLAPI API = "graphql"
+
+	// graphQLPath is relative to the REST API base URL, so it resolves to
+	// https://api.github.com/graphql and to https://host/api/graphql for
+	// GitHub Enterprise Server
+	graphQLPath = "../graphql"
+)
+
+// graphQLTasks are the task types that can be retrieved using GraphQL.
+var graphQLTasks = []SyncTaskType{IssueSyncTask, PullRequestSyncTask}
+
+// ParseAPISelection parses the API to be used for each entity. The value can
+// be just "rest" or "graphql", applied to all the entities supporting
+// GraphQL, or a comma-separated list of entity:api pairs, e.g.
+// "pull-request:graphql,issue:rest".
+func ParseAPISelection(value string) (map[SyncTaskType]API, error) {
+	apis := make(map[SyncTaskType]API)
+	for _, t := range graphQLTasks {
+		apis[t] = RESTAPI
+	}
+
+	if value == "" {
+		return apis, nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+
+		tasks := graphQLTasks
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) == 2 {
+			task := SyncTaskType(parts[0])
+			if _, ok := apis[task]; !ok {
+				return nil, fmt.Errorf("entity %q cannot be retrieved using GraphQL", parts[0])
+			}
+
+			tasks = []SyncTaskType{task}
+			item = parts[1]
+		}
+
+		api := API(item)
+		if api != RESTAPI && api != GraphQLAPI {
+			return nil, fmt.Errorf("unknown API %q", item)
+		}
+
+		for _, t := range tasks {
+			apis[t] = api
+		}
+	}
+
+	return apis, nil
+}
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+func queryGraphQL(ctx context.Context, c *github.Client, query string, vars map[string]interface{}, data interface{}) error {
+	req, err := c.NewRequest("POST", graphQLPath, &graphQLRequest{query, vars})
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Data   interface{}    `json:"data"`
+		Errors []graphQLError `json:"errors"`
+	}
+
+	resp.Data = data
+	if _, err := c.Do(ctx, req, &resp); err != nil {
+		return err
+	}
+
+	if len(resp.Errors) != 0 {
+		msgs := make([]string, len(resp.Errors))
+		for i, e := range resp.Errors {
+			msgs[i] = e.Message
+		}
+
+		return fmt.Errorf("graphql query failed: %s", strings.Join(msgs, "; "))
+	}
+
+	return nil
+}
+
+const graphQLActorFragment = `
+fragment actor on Actor {
+  login
+  ... on User { databaseId }
+  ... on Bot { databaseId }
+  ... on Organization { databaseId }
+  ... on Mannequin { databaseId }
+}`
+
+// graphQLRepository has what the nodes of a repository retrieved using
+// GraphQL need to be converted to the values returned by the REST API, so
+// syncing an entity with either API writes the same columns.
+type graphQLRepository struct {
+	owner string
+	name  string
+	// url is the REST API URL of the repository
+	url string
+	// milestones are the IDs of the milestones by number, GraphQL doesn't
+	// provide them
+	milestones map[int]int64
+}
+
+// newGraphQLRepository lists the milestones of the repository using the REST
+// API, usually a single request.
+func newGraphQLRepository(ctx context.Context, c *github.Client, owner, name string) (*graphQLRepository, error) {
+	r := &graphQLRepository{
+		owner:      owner,
+		name:       name,
+		url:        fmt.Sprintf("%srepos/%s/%s", c.BaseURL, owner, name),
+		milestones: make(map[int]int64),
+	}
+
+	opts := &github.MilestoneListOptions{State: "all"}
+	opts.ListOptions.PerPage = listOptionsPerPage
+
+	for {
+		milestones, resp, err := c.Issues.ListMilestones(ctx, owner, name, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range milestones {
+			r.milestones[m.GetNumber()] = m.GetID()
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+
+		opts.Page = resp.NextPage
+	}
+
+	return r, nil
+}
+
+// issueURL returns the REST API URL of an issue, or of a pull request as an
+// issue.
+func (r *graphQLRepository) issueURL(number int) string {
+	return fmt.Sprintf("%s/issues/%d", r.url, number)
+}
+
+// pullRequestURL returns the REST API URL of a pull request.
+func (r *graphQLRepository) pullRequestURL(number int) string {
+	return fmt.Sprintf("%s/pulls/%d", r.url, number)
+}
+
+type graphQLPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type graphQLActor struct {
+	Login      string `json:"login"`
+	DatabaseID int64  `json:"databaseId"`
+}
+
+func (a *graphQLActor) toUser() *github.User {
+	if a == nil {
+		return nil
+	}
+
+	return &github.User{
+		ID:    github.Int64(a.DatabaseID),
+		Login: github.String(a.Login),
+	}
+}
+
+// graphQLActors are the first actors of a connection, PageInfo tells if
+// there are more of them than retrieved.
+type graphQLActors struct {
+	PageInfo graphQLPageInfo `json:"pageInfo"`
+	Nodes    []*graphQLActor `json:"nodes"`
+}
+
+func (a graphQLActors) toUsers() []*github.User {
+	users := make([]*github.User, 0, len(a.Nodes))
+	for _, n := range a.Nodes {
+		users = append(users, n.toUser())
+	}
+
+	return users
+}
+
+// graphQLLabels are the first labels of a connection, PageInfo tells if
+// there are more of them than retrieved.
+type graphQLLabels struct {
+	PageInfo graphQLPageInfo `json:"pageInfo"`
+	Nodes    []struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	} `json:"nodes"`
+}
+
+func (l graphQLLabels) toLabels() []github.Label {
+	labels := make([]github.Label, 0, len(l.Nodes))
+	for _, n := range l.Nodes {
+		labels = append(labels, github.Label{
+			Name:  github.String(n.Name),
+			Color: github.String(n.Color),
+		})
+	}
+
+	return labels
+}
+
+type graphQLMilestone struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+}
+
+func (m *graphQLMilestone) toMilestone(r *graphQLRepository) *github.Milestone {
+	if m == nil {
+		return nil
+	}
+
+	milestone := &github.Milestone{
+		Number: github.Int(m.Number),
+		Title:  github.String(m.Title),
+	}
+
+	if id, ok := r.milestones[m.Number]; ok {
+		milestone.ID = github.Int64(id)
+	}
+
+	return milestone
+}
+
+const graphQLIssueCommentFields = `
+id
+databaseId
+body
+url
+createdAt
+updatedAt
+authorAssociation
+author { ...actor }`
+
+type graphQLIssueComment struct {
+	ID                string        `json:"id"`
+	DatabaseID        int64         `json:"databaseId"`
+	Body              string        `json:"body"`
+	URL               string        `json:"url"`
+	CreatedAt         time.Time     `json:"createdAt"`
+	UpdatedAt         time.Time     `json:"updatedAt"`
+	AuthorAssociation string        `json:"authorAssociation"`
+	Author            *graphQLActor `json:"author"`
+}
+
+// toIssueComment converts the comment, issueURL is the URL of the issue or
+// pull request it belongs to.
+func (c *graphQLIssueComment) toIssueComment(issueURL string) *github.IssueComment {
+	return &github.IssueComment{
+		ID:                github.Int64(c.DatabaseID),
+		NodeID:            github.String(c.ID),
+		Body:              github.String(c.Body),
+		User:              c.Author.toUser(),
+		CreatedAt:         &c.CreatedAt,
+		UpdatedAt:         &c.UpdatedAt,
+		AuthorAssociation: github.String(c.AuthorAssociation),
+		HTMLURL:           github.String(c.URL),
+		IssueURL:          github.String(issueURL),
+	}
+}
+
+type graphQLIssueComments struct {
+	PageInfo graphQLPageInfo        `json:"pageInfo"`
+	Nodes    []*graphQLIssueComment `json:"nodes"`
+}
+
+func toState(state string) *string {
+	switch state {
+	case "OPEN":
+		return github.String("open")
+	default:
+		return github.String("closed")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
@@ -13,18 +14,20 @@ import (
 )
 
 type IssueSyncer struct {
-	s *models.IssueStore
-	c *github.Client
+	s     *models.IssueStore
+	c     *github.Client
+	stats *utils.Stats
 }
 
-func NewIssueSyncer(db *sql.DB, c *github.Client) *IssueSyncer {
+func NewIssueSyncer(db *sql.DB, c *github.Client, stats *utils.Stats) *IssueSyncer {
 	return &IssueSyncer{
-		s: models.NewIssueStore(db),
-		c: c,
+		s:     models.NewIssueStore(db),
+		c:     c,
+		stats: stats,
 	}
 }
 
-func (s *IssueSyncer) QueueRepository(q queue.Queue, owner, repo string) error {
+func (s *IssueSyncer) QueueRepository(ctx context.Context, q queue.Queue, p *Progress, owner, repo string) error {
 	opts := &github.IssueListByRepoOptions{}
 	opts.ListOptions.PerPage = listOptionsPerPage
 	opts.State = "all"
@@ -33,29 +36,39 @@ func (s *IssueSyncer) QueueRepository(q queue.Queue, owner, repo string) error {
 	logger.Infof("starting to publish queue jobs")
 
 	for {
-		issues, r, err := s.c.Issues.ListByRepo(context.TODO(), owner, repo, opts)
+		issues, r, err := s.c.Issues.ListByRepo(ctx, owner, repo, opts)
 		if err != nil {
 			return err
 		}
 
+		var published int
 		for _, i := range issues {
 			if i.PullRequestLinks != nil {
 				continue
 			}
 
-			j, err := NewIssueSyncJob(owner, repo, i.GetNumber())
+			j, err := NewIssueSyncJob(ctx, owner, repo, i.GetNumber(), i.GetUpdatedAt())
 			if err != nil {
 				return err
 			}
 
 			l := logger.With(log.Fields{"issue": i.GetNumber()})
 			l.Debugf("queue request")
-			if err := q.Publish(j); err != nil {
+			ok, err := publish(q, j)
+			if err != nil {
 				l.Errorf(err, "publishing job")
-				return nil
+				return p.Published(owner, IssueSyncTask, published)
+			}
+
+			if ok {
+				published++
 			}
 		}
 
+		if err := p.Published(owner, IssueSyncTask, published); err != nil {
+			return err
+		}
+
 		if r.NextPage == 0 {
 			break
 		}
@@ -68,29 +81,90 @@ func (s *IssueSyncer) QueueRepository(q queue.Queue, owner, repo string) error {
 	return nil
 }
 
-func (s *IssueSyncer) Sync(owner string, repo string, number int) error {
-	issue, _, err := s.c.Issues.Get(context.TODO(), owner, repo, number)
+// SyncRepository syncs all the issues of a repository, without publishing
+// any job to the queue.
+func (s *IssueSyncer) SyncRepository(ctx context.Context, owner, repo string) error {
+	opts := &github.IssueListByRepoOptions{}
+	opts.ListOptions.PerPage = listOptionsPerPage
+	opts.State = "all"
+
+	for {
+		issues, r, err := s.c.Issues.ListByRepo(ctx, owner, repo, opts)
+		if err != nil {
+			return err
+		}
+
+		if err := s.doSyncAll(ctx, issues); err != nil {
+			return err
+		}
+
+		if r.NextPage == 0 {
+			break
+		}
+
+		opts.Page = r.NextPage
+	}
+
+	return nil
+}
+
+func (s *IssueSyncer) Sync(ctx context.Context, owner string, repo string, number int) error {
+	issue, _, err := s.c.Issues.Get(ctx, owner, repo, number)
 	if err != nil {
 		return err
 	}
 
+	return s.doSync(ctx, owner, repo, issue)
+}
+
+// doSyncAll writes the issues of a listing page in a single batch, skipping
+// the pull requests listed along with them.
+func (s *IssueSyncer) doSyncAll(ctx context.Context, issues []*github.Issue) error {
+	batch := models.NewBatch(models.Schema.Issue.BaseSchema)
+	for _, i := range issues {
+		if i.PullRequestLinks != nil {
+			continue
+		}
+
+		record := models.NewIssue()
+		record.Issue = *i
+
+		if err := batch.Add(record); err != nil {
+			s.stats.Record(utils.IssueEntity, utils.Failed, err)
+			return err
+		}
+	}
+
+	return upsert(ctx, s.s.Store, batch, utils.IssueEntity, s.stats)
+}
+
+func (s *IssueSyncer) doSync(ctx context.Context, owner, repo string, issue *github.Issue) error {
+	end := utils.StartStoreOp(ctx, "find", utils.IssueEntity)
 	record, err := s.s.FindOne(models.NewIssueQuery().
 		Where(kallax.And(
 			kallax.Eq(models.Schema.Issue.RepositoryOwner, owner),
 			kallax.Eq(models.Schema.Issue.RepositoryName, repo),
-			kallax.Eq(models.Schema.Issue.Number, number),
+			kallax.Eq(models.Schema.Issue.Number, issue.GetNumber()),
 		)),
 	)
+	end(err)
 
 	if record == nil {
 		record = models.NewIssue()
 		record.Issue = *issue
 
-		return s.s.Insert(record)
+		end := utils.StartStoreOp(ctx, "insert", utils.IssueEntity)
+		err = s.s.Insert(record)
+		end(err)
+		s.stats.Record(utils.IssueEntity, utils.Inserted, err)
+		return err
 	}
 
 	record.Issue = *issue
+	end = utils.StartStoreOp(ctx, "update", utils.IssueEntity)
 	_, err = s.s.Update(record)
+	end(err)
+	s.stats.Record(utils.IssueEntity, utils.Updated, err)
 	return err
 
 }
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
@@ -12,75 +13,115 @@ import (
 )
 
 type IssueCommentsSyncer struct {
-	s *models.IssueCommentStore
-	c *github.Client
+	s     *models.IssueCommentStore
+	c     *github.Client
+	stats *utils.Stats
 }
 
-func NewIssueCommentsSyncer(db *sql.DB, c *github.Client) *IssueCommentsSyncer {
+func NewIssueCommentsSyncer(db *sql.DB, c *github.Client, stats *utils.Stats) *IssueCommentsSyncer {
 	return &IssueCommentsSyncer{
-		s: models.NewIssueCommentStore(db),
-		c: c,
+		s:     models.NewIssueCommentStore(db),
+		c:     c,
+		stats: stats,
 	}
 }
 
-func (s *IssueCommentsSyncer) SyncRepository(owner, repo string) error {
-	return s.SyncIssue(owner, repo, 0)
+func (s *IssueCommentsSyncer) SyncRepository(ctx context.Context, owner, repo string) error {
+	return s.SyncIssue(ctx, owner, repo, 0)
 }
 
-func (s *IssueCommentsSyncer) SyncIssue(owner, repo string, number int) error {
-	opts := &github.IssueListCommentsOptions{}
-	opts.ListOptions.PerPage = listOptionsPerPage
-
-	logger := log.New(log.Fields{
-		"type":  IssueCommentSyncTask,
-		"owner": owner, "repo": repo, "number": number,
-	})
-
+func (s *IssueCommentsSyncer) SyncIssue(ctx context.Context, owner, repo string, number int) error {
+	page := 0
 	for {
-		comments, r, err := s.c.Issues.ListComments(context.TODO(), owner, repo, number, opts)
+		r, err := s.syncPage(ctx, owner, repo, number, page)
 		if err != nil {
 			return err
 		}
 
-		for _, c := range comments {
-			if err := s.doSync(c); err != nil {
-				logger.Errorf(err, "issue sync error")
-			}
-		}
-
 		if r.NextPage == 0 {
 			break
 		}
 
-		opts.Page = r.NextPage
+		page = r.NextPage
 	}
 
 	return nil
 }
 
-func (s *IssueCommentsSyncer) Sync(owner string, repo string, commentID int64) error {
-	comment, _, err := s.c.Issues.GetComment(context.TODO(), owner, repo, commentID)
+// SyncPage syncs a page of the comments of a repository, sorted by creation.
+// The response tells the pages following it.
+func (s *IssueCommentsSyncer) SyncPage(ctx context.Context, owner, repo string, page int) (*github.Response, error) {
+	return s.syncPage(ctx, owner, repo, 0, page)
+}
+
+func (s *IssueCommentsSyncer) syncPage(ctx context.Context, owner, repo string, number, page int) (*github.Response, error) {
+	opts := &github.IssueListCommentsOptions{Sort: "created", Direction: "asc"}
+	opts.ListOptions.PerPage = listOptionsPerPage
+	opts.Page = page
+
+	logger := log.New(log.Fields{
+		"type":  IssueCommentSyncTask,
+		"owner": owner, "repo": repo, "number": number, "page": page,
+	})
+
+	comments, r, err := s.c.Issues.ListComments(ctx, owner, repo, number, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.doSyncAll(ctx, comments, logger)
+	return r, nil
+}
+
+func (s *IssueCommentsSyncer) Sync(ctx context.Context, owner string, repo string, commentID int64) error {
+	comment, _, err := s.c.Issues.GetComment(ctx, owner, repo, commentID)
 	if err != nil {
 		return err
 	}
 
-	return s.doSync(comment)
+	return s.doSync(ctx, comment)
 }
 
-func (s *IssueCommentsSyncer) doSync(comment *github.IssueComment) error {
+// doSyncAll writes the comments of a listing page in a single batch. The
+// comments that can't be written are logged and skipped.
+func (s *IssueCommentsSyncer) doSyncAll(ctx context.Context, comments []*github.IssueComment, logger log.Logger) {
+	batch := models.NewBatch(models.Schema.IssueComment.BaseSchema)
+	for _, c := range comments {
+		record := models.NewIssueComment()
+		record.IssueComment = *c
+
+		if err := batch.Add(record); err != nil {
+			s.stats.Record(utils.CommentEntity, utils.Failed, err)
+			logger.With(log.Fields{"comment": c.GetID()}).Errorf(err, "issue comment sync error")
+		}
+	}
+
+	upsertOrEach(ctx, s.s.Store, batch, utils.CommentEntity, s.stats, logger)
+}
+
+func (s *IssueCommentsSyncer) doSync(ctx context.Context, comment *github.IssueComment) error {
+	end := utils.StartStoreOp(ctx, "find", utils.CommentEntity)
 	record, err := s.s.FindOne(models.NewIssueCommentQuery().
 		Where(kallax.Eq(models.Schema.IssueComment.ID, comment.GetID())),
 	)
+	end(err)
 
 	if record == nil {
 		record = models.NewIssueComment()
 		record.IssueComment = *comment
 
-		return s.s.Insert(record)
+		end := utils.StartStoreOp(ctx, "insert", utils.CommentEntity)
+		err = s.s.Insert(record)
+		end(err)
+		s.stats.Record(utils.CommentEntity, utils.Inserted, err)
+		return err
 	}
 
 	record.IssueComment = *comment
+	end = utils.StartStoreOp(ctx, "update", utils.CommentEntity)
 	_, err = s.s.Update(record)
+	end(err)
+	s.stats.Record(utils.CommentEntity, utils.Updated, err)
 	return err
 
 }
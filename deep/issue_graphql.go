@@ -0,0 +1,216 @@
+package deep
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+const graphQLIssuesPerPage = 50
+
+const graphQLIssuesQuery = `
+query($owner: String!, $name: String!, $perPage: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    issues(first: $perPage, after: $cursor) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        id
+        databaseId
+        number
+        state
+        locked
+        title
+        body
+        url
+        createdAt
+        updatedAt
+        closedAt
+        author { ...actor }
+        milestone { number title }
+        labels(first: 100) { pageInfo { hasNextPage } nodes { name color } }
+        assignees(first: 100) { pageInfo { hasNextPage } nodes { ...actor } }
+        timelineItems(itemTypes: [CLOSED_EVENT], last: 1) {
+          nodes { ... on ClosedEvent { actor { ...actor } } }
+        }
+        comments(first: 100) {
+          totalCount
+          pageInfo { hasNextPage endCursor }
+          nodes {` + graphQLIssueCommentFields + `
+          }
+        }
+      }
+    }
+  }
+}` + graphQLActorFragment
+
+type graphQLIssue struct {
+	ID         string            `json:"id"`
+	DatabaseID int64             `json:"databaseId"`
+	Number     int               `json:"number"`
+	State      string            `json:"state"`
+	Locked     bool              `json:"locked"`
+	Title      string            `json:"title"`
+	Body       string            `json:"body"`
+	URL        string            `json:"url"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+	ClosedAt   *time.Time        `json:"closedAt"`
+	Author     *graphQLActor     `json:"author"`
+	Milestone  *graphQLMilestone `json:"milestone"`
+	Labels     graphQLLabels     `json:"labels"`
+	Assignees  graphQLActors     `json:"assignees"`
+	// TimelineItems has the last event closing the issue, if any
+	TimelineItems struct {
+		Nodes []struct {
+			Actor *graphQLActor `json:"actor"`
+		} `json:"nodes"`
+	} `json:"timelineItems"`
+	Comments struct {
+		TotalCount int `json:"totalCount"`
+		graphQLIssueComments
+	} `json:"comments"`
+}
+
+func (i *graphQLIssue) toIssue(r *graphQLRepository) *github.Issue {
+	issue := &github.Issue{
+		ID:        github.Int64(i.DatabaseID),
+		NodeID:    github.String(i.ID),
+		Number:    github.Int(i.Number),
+		State:     toState(i.State),
+		Locked:    github.Bool(i.Locked),
+		Title:     github.String(i.Title),
+		Body:      github.String(i.Body),
+		User:      i.Author.toUser(),
+		Labels:    i.Labels.toLabels(),
+		Assignees: i.Assignees.toUsers(),
+		Comments:  github.Int(i.Comments.TotalCount),
+		Milestone: i.Milestone.toMilestone(r),
+		CreatedAt: &i.CreatedAt,
+		UpdatedAt: &i.UpdatedAt,
+		ClosedAt:  i.ClosedAt,
+		URL:       github.String(r.issueURL(i.Number)),
+		HTMLURL:   github.String(i.URL),
+	}
+
+	if len(issue.Assignees) != 0 {
+		issue.Assignee = issue.Assignees[0]
+	}
+
+	// the REST API only returns who closed the issue while it's closed
+	if nodes := i.TimelineItems.Nodes; i.State == "CLOSED" && len(nodes) != 0 {
+		issue.ClosedBy = nodes[0].Actor.toUser()
+	}
+
+	return issue
+}
+
+// truncated returns true if the issue has more labels or assignees than the
+// ones retrieved.
+func (i *graphQLIssue) truncated() bool {
+	return i.Labels.PageInfo.HasNextPage || i.Assignees.PageInfo.HasNextPage
+}
+
+// SyncRepositoryGraphQL retrieves all the issues of a repository, including
+// their comments, using the GraphQL API. The issues with more labels or
+// assignees than the ones retrieved in a single query are retrieved using the
+// REST API. The comments are skipped if the comments syncer is nil.
+func (s *IssueSyncer) SyncRepositoryGraphQL(ctx context.Context, comments *IssueCommentsSyncer, owner, repo string) error {
+	logger := log.New(log.Fields{"type": IssueSyncTask, "owner": owner, "repo": repo, "api": GraphQLAPI})
+	logger.Infof("starting to retrieve issues")
+
+	vars := map[string]interface{}{
+		"owner":   owner,
+		"name":    repo,
+		"perPage": graphQLIssuesPerPage,
+		"cursor":  nil,
+	}
+
+	r, err := newGraphQLRepository(ctx, s.c, owner, repo)
+	if err != nil {
+		return err
+	}
+
+	for {
+		var data struct {
+			Repository struct {
+				Issues struct {
+					PageInfo graphQLPageInfo `json:"pageInfo"`
+					Nodes    []*graphQLIssue `json:"nodes"`
+				} `json:"issues"`
+			} `json:"repository"`
+		}
+
+		if err := queryGraphQL(ctx, s.c, graphQLIssuesQuery, vars, &data); err != nil {
+			return err
+		}
+
+		issues := data.Repository.Issues
+		page := make([]*github.Issue, len(issues.Nodes))
+		for n, i := range issues.Nodes {
+			if !i.truncated() {
+				page[n] = i.toIssue(r)
+				continue
+			}
+
+			logger.With(log.Fields{"issue": i.Number}).Debugf("too many labels or assignees, falling back to REST")
+			issue, _, err := s.c.Issues.Get(ctx, owner, repo, i.Number)
+			if err != nil {
+				return err
+			}
+
+			page[n] = issue
+		}
+
+		if err := s.doSyncAll(ctx, page); err != nil {
+			return err
+		}
+
+		if comments != nil {
+			if err := s.syncGraphQLComments(ctx, comments, r, issues.Nodes, logger); err != nil {
+				return err
+			}
+		}
+
+		if !issues.PageInfo.HasNextPage {
+			break
+		}
+
+		vars["cursor"] = issues.PageInfo.EndCursor
+	}
+
+	logger.Infof("finished to retrieve issues")
+
+	return nil
+}
+
+// syncGraphQLComments writes the comments retrieved along with a page of
+// issues in a single batch. The comments of the issues with more of them
+// than retrieved are synced with the REST API.
+func (s *IssueSyncer) syncGraphQLComments(
+	ctx context.Context,
+	comments *IssueCommentsSyncer,
+	r *graphQLRepository,
+	issues []*graphQLIssue,
+	logger log.Logger,
+) error {
+	var page []*github.IssueComment
+	for _, i := range issues {
+		if i.Comments.PageInfo.HasNextPage {
+			logger.With(log.Fields{"issue": i.Number}).Debugf("too many comments, falling back to REST")
+			if err := comments.SyncIssue(ctx, r.owner, r.name, i.Number); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		for _, c := range i.Comments.Nodes {
+			page = append(page, c.toIssueComment(r.issueURL(i.Number)))
+		}
+	}
+
+	comments.doSyncAll(ctx, page, logger)
+	return nil
+}
@@ -0,0 +1,75 @@
+package deep
+
+import (
+	"context"
+	"fmt"
+
+	"gopkg.in/src-d/go-queue.v1"
+)
+
+// Lane is the priority lane of a job. The jobs of a higher lane are handled
+// first, the jobs published while handling a job go to its same lane.
+type Lane string
+
+const (
+	// HighLane is the lane of the jobs requested manually, that shouldn't
+	// wait for the jobs of a whole organization
+	HighLane Lane = "high"
+	// NormalLane is the default lane
+	NormalLane Lane = "normal"
+	// BackfillLane is the lane of the historical syncs, handled when there
+	// are no other jobs waiting
+	BackfillLane Lane = "backfill"
+)
+
+// lanePriorities are the priorities of the jobs of each lane, the AMQP broker
+// delivers first the jobs with a higher priority.
+var lanePriorities = map[Lane]queue.Priority{
+	HighLane:     queue.PriorityUrgent,
+	NormalLane:   queue.PriorityNormal,
+	BackfillLane: queue.PriorityLow,
+}
+
+// ParseLane parses the name of a lane, the normal one is returned if it's
+// empty.
+func ParseLane(value string) (Lane, error) {
+	if value == "" {
+		return NormalLane, nil
+	}
+
+	l := Lane(value)
+	if _, ok := lanePriorities[l]; !ok {
+		return "", fmt.Errorf("unknown lane %q", value)
+	}
+
+	return l, nil
+}
+
+// jobLane returns the lane of a job given its priority.
+func jobLane(p queue.Priority) Lane {
+	switch {
+	case p >= queue.PriorityUrgent:
+		return HighLane
+	case p > queue.PriorityLow:
+		return NormalLane
+	default:
+		return BackfillLane
+	}
+}
+
+type laneKey struct{}
+
+// WithLane returns a context where the jobs are published to the given lane.
+func WithLane(ctx context.Context, l Lane) context.Context {
+	return context.WithValue(ctx, laneKey{}, l)
+}
+
+// laneFromContext returns the lane of the jobs published with ctx, the normal
+// one if it wasn't set.
+func laneFromContext(ctx context.Context) Lane {
+	if l, ok := ctx.Value(laneKey{}).(Lane); ok {
+		return l
+	}
+
+	return NormalLane
+}
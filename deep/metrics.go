@@ -0,0 +1,47 @@
+package deep
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	jobsHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ghsync",
+		Subsystem: "deep",
+		Name:      "jobs_total",
+		Help:      "Deep sync jobs handled by task type and result, done, failed or rejected.",
+	}, []string{"type", "result"})
+
+	jobsDeduplicated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ghsync",
+		Subsystem: "deep",
+		Name:      "jobs_deduplicated_total",
+		Help:      "Deep sync jobs not published because they were pending or handled recently, by task type.",
+	}, []string{"type"})
+
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ghsync",
+		Subsystem: "deep",
+		Name:      "job_duration_seconds",
+		Help:      "Duration of the deep sync jobs by task type.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 4, 8),
+	}, []string{"type"})
+)
+
+func init() {
+	prometheus.MustRegister(jobsHandled, jobsDeduplicated, jobDuration)
+}
+
+// observeJob records a job of the task type started at start, failed if err
+// is not nil.
+func observeJob(t SyncTaskType, start time.Time, err error) {
+	result := "done"
+	if err != nil {
+		result = "failed"
+	}
+
+	jobsHandled.WithLabelValues(string(t), result).Inc()
+	jobDuration.WithLabelValues(string(t)).Observe(time.Since(start).Seconds())
+}
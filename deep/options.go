@@ -0,0 +1,171 @@
+package deep
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/src-d/ghsync/utils"
+)
+
+// JobOptions are the options a job was requested with. They replace the ones
+// of the worker handling the job, and the jobs published while handling it
+// inherit them, like its lane. The zero value keeps the worker options.
+type JobOptions struct {
+	// Entities are the names of the entities synced, the ones of the worker
+	// if it's empty
+	Entities []string
+	// API is the API used to retrieve each entity, as accepted by
+	// ParseAPISelection, the one of the worker if it's empty
+	API string
+	// Filter selects the repositories of the organizations synced, the one
+	// of the worker is used if it's nil
+	Filter *RepositoryFilterOptions
+}
+
+// RepositoryFilterOptions are the options of a utils.RepositoryFilter, in a
+// form that can be encoded in the jobs.
+type RepositoryFilterOptions struct {
+	// Include and Exclude are the patterns accepted by utils.NewNamePattern
+	Include      []string
+	Exclude      []string
+	NoForks      bool
+	NoArchived   bool
+	Visibility   string
+	Topics       []string
+	Languages    []string
+	PushedWithin time.Duration
+}
+
+// Filter returns the repository filter of the options.
+func (o *RepositoryFilterOptions) Filter() (*utils.RepositoryFilter, error) {
+	include, err := utils.NewNamePatterns(o.Include)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := utils.NewNamePatterns(o.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &utils.RepositoryFilter{
+		Include:      include,
+		Exclude:      exclude,
+		SkipArchived: o.NoArchived,
+		SkipForks:    o.NoForks,
+		Visibility:   o.Visibility,
+		Topics:       o.Topics,
+		Languages:    o.Languages,
+		PushedWithin: o.PushedWithin,
+	}, nil
+}
+
+// IsZero returns true if no option is set.
+func (o JobOptions) IsZero() bool {
+	return len(o.Entities) == 0 && o.API == "" && o.Filter == nil
+}
+
+// Validate returns an error if any of the options is not valid.
+func (o JobOptions) Validate() error {
+	if _, err := utils.ParseEntities(o.Entities); err != nil {
+		return fmt.Errorf("invalid entities option: %v", err)
+	}
+
+	if _, err := ParseAPISelection(o.API); err != nil {
+		return fmt.Errorf("invalid API option: %v", err)
+	}
+
+	if o.Filter != nil {
+		if _, err := o.Filter.Filter(); err != nil {
+			return fmt.Errorf("invalid filter option: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// key returns the options as part of the idempotency key of a job, so a job
+// requested with other options is not skipped as duplicated.
+func (o JobOptions) key() string {
+	if o.IsZero() {
+		return ""
+	}
+
+	var parts []string
+	if len(o.Entities) != 0 {
+		entities := append([]string{}, o.Entities...)
+		sort.Strings(entities)
+		parts = append(parts, "entities="+strings.Join(entities, ","))
+	}
+
+	if o.API != "" {
+		parts = append(parts, "api="+o.API)
+	}
+
+	if o.Filter != nil {
+		parts = append(parts, fmt.Sprintf("filter=%+v", *o.Filter))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+type optionsKey struct{}
+
+// WithOptions returns a context where the jobs are published with the given
+// options.
+func WithOptions(ctx context.Context, o JobOptions) context.Context {
+	return context.WithValue(ctx, optionsKey{}, o)
+}
+
+// optionsFromContext returns the options of the jobs published with ctx, the
+// zero value if they weren't set.
+func optionsFromContext(ctx context.Context) JobOptions {
+	o, _ := ctx.Value(optionsKey{}).(JobOptions)
+	return o
+}
+
+// entities returns the entities synced with ctx, the ones of its job if they
+// were given or the ones of the syncer otherwise.
+func (s *Syncer) entities(ctx context.Context) utils.Entities {
+	o := optionsFromContext(ctx)
+	if len(o.Entities) == 0 {
+		return s.Entities
+	}
+
+	// they are validated when the job is published and decoded
+	entities, _ := utils.ParseEntities(o.Entities)
+	return entities
+}
+
+// api returns the API used to retrieve the entity of the task type with ctx,
+// the one of its job if it was given or the one of the syncer otherwise. REST
+// is used for the entities not present.
+func (s *Syncer) api(ctx context.Context, t SyncTaskType) API {
+	apis := s.API
+	if o := optionsFromContext(ctx); o.API != "" {
+		// it's validated when the job is published and decoded
+		apis, _ = ParseAPISelection(o.API)
+	}
+
+	if api, ok := apis[t]; ok {
+		return api
+	}
+
+	return RESTAPI
+}
+
+// filter returns the repository filter of ctx, the one of its job if it was
+// given or the one of the syncer otherwise.
+func (s *RepositorySyncer) filter(ctx context.Context) *utils.RepositoryFilter {
+	o := optionsFromContext(ctx)
+	if o.Filter == nil {
+		return s.Filter
+	}
+
+	// it's validated when the job is published and decoded
+	f, _ := o.Filter.Filter()
+	return f
+}
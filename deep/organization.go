@@ -5,42 +5,54 @@ import (
 	"database/sql"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
 )
 
 type OrganizationSyncer struct {
-	s *models.OrganizationStore
-	c *github.Client
+	s     *models.OrganizationStore
+	c     *github.Client
+	stats *utils.Stats
 }
 
-func NewOrganizationSyncer(db *sql.DB, c *github.Client) *OrganizationSyncer {
+func NewOrganizationSyncer(db *sql.DB, c *github.Client, stats *utils.Stats) *OrganizationSyncer {
 	return &OrganizationSyncer{
-		s: models.NewOrganizationStore(db),
-		c: c,
+		s:     models.NewOrganizationStore(db),
+		c:     c,
+		stats: stats,
 	}
 }
 
-func (s *OrganizationSyncer) Sync(login string) error {
-	org, _, err := s.c.Organizations.Get(context.TODO(), login)
+func (s *OrganizationSyncer) Sync(ctx context.Context, login string) error {
+	org, _, err := s.c.Organizations.Get(ctx, login)
 	if err != nil {
 		return err
 	}
 
+	end := utils.StartStoreOp(ctx, "find", utils.OrganizationEntity)
 	record, err := s.s.FindOne(models.NewOrganizationQuery().
 		Where(kallax.Eq(models.Schema.Organization.Login, login)),
 	)
+	end(err)
 
 	if record == nil {
 		record = models.NewOrganization()
 		record.Organization = *org
 
-		return s.s.Insert(record)
+		end := utils.StartStoreOp(ctx, "insert", utils.OrganizationEntity)
+		err = s.s.Insert(record)
+		end(err)
+		s.stats.Record(utils.OrganizationEntity, utils.Inserted, err)
+		return err
 	}
 
 	record.Organization = *org
+	end = utils.StartStoreOp(ctx, "update", utils.OrganizationEntity)
 	_, err = s.s.Update(record)
+	end(err)
+	s.stats.Record(utils.OrganizationEntity, utils.Updated, err)
 	return err
 
 }
@@ -0,0 +1,110 @@
+package deep
+
+import (
+	"fmt"
+
+	"gopkg.in/src-d/go-log.v1"
+	"gopkg.in/src-d/go-queue.v1"
+	"gopkg.in/vmihailenco/msgpack.v2"
+)
+
+// PayloadVersion is the version of the payload format of the jobs published.
+// The workers reject the jobs with a newer version. The version 2 added the
+// job options.
+const PayloadVersion = 2
+
+// Payload is the payload of a deep sync job.
+type Payload interface {
+	// Validate returns an error if a field required to handle the job is
+	// missing.
+	Validate() error
+	// Fields returns the fields of the payload to log along with the job.
+	Fields() log.Fields
+}
+
+// payloads are the payload types of each task type.
+var payloads = map[SyncTaskType]func() Payload{
+	OrganizationSyncTask:       func() Payload { return &OrganizationSyncPayload{} },
+	RepositorySyncTask:         func() Payload { return &RepositorySyncPayload{} },
+	UserSyncTask:               func() Payload { return &UserSyncPayload{} },
+	IssueSyncTask:              func() Payload { return &IssueSyncPayload{} },
+	PullRequestSyncTask:        func() Payload { return &IssueSyncPayload{} },
+	IssueCommentSyncTask:       func() Payload { return &IssueCommentSyncPayload{} },
+	PullRequestCommentSyncTask: func() Payload { return &IssueCommentSyncPayload{} },
+	PullRequestReviewSyncTask:  func() Payload { return &PullRequestReviewSyncPayload{} },
+
+	IssueCommentPageSyncTask:       func() Payload { return &CommentPageSyncPayload{} },
+	PullRequestCommentPageSyncTask: func() Payload { return &CommentPageSyncPayload{} },
+}
+
+// decodeJob decodes a job and its payload into the payload type of its task
+// type, returning an error if the job is malformed.
+func decodeJob(j *queue.Job) (*SyncTasks, Payload, error) {
+	var task *SyncTasks
+	if err := j.Decode(&task); err != nil {
+		return nil, nil, fmt.Errorf("unable to decode the job: %v", err)
+	}
+
+	if task == nil {
+		return nil, nil, fmt.Errorf("empty job")
+	}
+
+	if task.Version > PayloadVersion {
+		return task, nil, fmt.Errorf("unsupported payload version %d, the latest supported is %d",
+			task.Version, PayloadVersion)
+	}
+
+	newPayload, ok := payloads[task.Type]
+	if !ok {
+		return task, nil, fmt.Errorf("unknown task type %q", task.Type)
+	}
+
+	// the payload is decoded as a map, it's encoded again to decode it into
+	// its type
+	raw, err := msgpack.Marshal(task.Payload)
+	if err != nil {
+		return task, nil, fmt.Errorf("unable to read the payload: %v", err)
+	}
+
+	payload := newPayload()
+	if err := msgpack.Unmarshal(raw, payload); err != nil {
+		return task, nil, fmt.Errorf("malformed %s payload: %v", task.Type, err)
+	}
+
+	if err := payload.Validate(); err != nil {
+		return task, nil, fmt.Errorf("invalid %s payload: %v", task.Type, err)
+	}
+
+	if err := task.Options.Validate(); err != nil {
+		return task, nil, fmt.Errorf("invalid %s job: %v", task.Type, err)
+	}
+
+	return task, payload, nil
+}
+
+// deadLetter rejects a malformed job without putting it back in the queue.
+// The AMQP broker moves it to the buried queue, where it can be inspected
+// and republished.
+func deadLetter(j *queue.Job, task *SyncTasks, err error) error {
+	t := SyncTaskType("unknown")
+	if task != nil && payloads[task.Type] != nil {
+		t = task.Type
+	}
+
+	log.With(log.Fields{"job": j.ID, "type": t}).Errorf(err, "malformed job, rejecting it")
+	jobsHandled.WithLabelValues(string(t), "rejected").Inc()
+
+	return j.Reject(false)
+}
+
+func validateRepository(owner, name string) error {
+	if owner == "" {
+		return fmt.Errorf("missing owner")
+	}
+
+	if name == "" {
+		return fmt.Errorf("missing name")
+	}
+
+	return nil
+}
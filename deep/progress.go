@@ -0,0 +1,138 @@
+package deep
+
+import (
+	"database/sql"
+	"fmt"
+
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// Progress tracks the deep sync of each organization in a table, counting
+// the jobs published and handled per task type. All its methods can be
+// called on a nil Progress, that doesn't track anything.
+type Progress struct {
+	db        *sql.DB
+	tableName string
+}
+
+// NewProgress returns a Progress that writes into the given table, as
+// created by CreateProgressTable.
+func NewProgress(db *sql.DB, tableName string) *Progress {
+	return &Progress{db: db, tableName: tableName}
+}
+
+// CreateProgressTable creates the progress table if it doesn't exist.
+func CreateProgressTable(db *sql.DB, tableName string) error {
+	stm := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+    id serial PRIMARY KEY,
+    org VARCHAR (50) NOT NULL,
+    task VARCHAR (30) NOT NULL,
+    published INTEGER NOT NULL DEFAULT 0,
+    done INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    UNIQUE (org, task)
+);`, tableName)
+	log.Debugf("running statement: %s", stm)
+	if _, err := db.Exec(stm); err != nil {
+		return fmt.Errorf("an error occured while ensuring the %s table: %v", tableName, err)
+	}
+
+	return nil
+}
+
+// Reset clears the progress of an organization, before its jobs are
+// published again.
+func (p *Progress) Reset(org string) error {
+	if p == nil {
+		return nil
+	}
+
+	stm := fmt.Sprintf("DELETE FROM %s WHERE org=$1", p.tableName)
+	if _, err := p.db.Exec(stm, org); err != nil {
+		return fmt.Errorf("an error occured while updating %s table: %v", p.tableName, err)
+	}
+
+	return nil
+}
+
+// Restart clears the progress of an organization and counts the job of its
+// sync, published by publish, that returns false if the job was not
+// published. It's done in a transaction committed once the job is
+// published, so the counts of a worker handling it right away wait for it
+// instead of being cleared, and the previous progress is kept if the job is
+// not published.
+func (p *Progress) Restart(org string, publish func() (bool, error)) error {
+	if p == nil {
+		_, err := publish()
+		return err
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return fmt.Errorf("an error occured while updating %s table: %v", p.tableName, err)
+	}
+
+	stm := fmt.Sprintf("DELETE FROM %s WHERE org=$1", p.tableName)
+	if _, err := tx.Exec(stm, org); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("an error occured while updating %s table: %v", p.tableName, err)
+	}
+
+	if err := p.addTx(tx, org, OrganizationSyncTask, "published", 1); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	ok, err := publish()
+	if err != nil || !ok {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("an error occured while updating %s table: %v", p.tableName, err)
+	}
+
+	return nil
+}
+
+// Published adds n jobs of the task type published for the organization.
+func (p *Progress) Published(org string, t SyncTaskType, n int) error {
+	return p.add(org, t, "published", n)
+}
+
+// Handled adds a job of the task type handled for the organization, failed
+// if err is not nil.
+func (p *Progress) Handled(org string, t SyncTaskType, err error) error {
+	if err != nil {
+		return p.add(org, t, "failed", 1)
+	}
+
+	return p.add(org, t, "done", 1)
+}
+
+func (p *Progress) add(org string, t SyncTaskType, column string, n int) error {
+	if p == nil || n == 0 {
+		return nil
+	}
+
+	return p.addTx(p.db, org, t, column, n)
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (p *Progress) addTx(tx execer, org string, t SyncTaskType, column string, n int) error {
+	stm := fmt.Sprintf(`INSERT INTO %[1]s (org, task, %[2]s) VALUES ($1, $2, $3)
+ON CONFLICT (org, task) DO UPDATE SET %[2]s=%[1]s.%[2]s + EXCLUDED.%[2]s, updated_at=now()`,
+		p.tableName, column)
+	if _, err := tx.Exec(stm, org, string(t), n); err != nil {
+		return fmt.Errorf("an error occured while updating %s table: %v", p.tableName, err)
+	}
+
+	return nil
+}
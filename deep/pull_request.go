@@ -5,6 +5,7 @@ import (
 	"database/sql"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
@@ -13,18 +14,20 @@ import (
 )
 
 type PullRequestSyncer struct {
-	s *models.PullRequestStore
-	c *github.Client
+	s     *models.PullRequestStore
+	c     *github.Client
+	stats *utils.Stats
 }
 
-func NewPullRequestSyncer(db *sql.DB, c *github.Client) *PullRequestSyncer {
+func NewPullRequestSyncer(db *sql.DB, c *github.Client, stats *utils.Stats) *PullRequestSyncer {
 	return &PullRequestSyncer{
-		s: models.NewPullRequestStore(db),
-		c: c,
+		s:     models.NewPullRequestStore(db),
+		c:     c,
+		stats: stats,
 	}
 }
 
-func (s *PullRequestSyncer) QueueRepository(q queue.Queue, owner, repo string) error {
+func (s *PullRequestSyncer) QueueRepository(ctx context.Context, q queue.Queue, p *Progress, owner, repo string) error {
 	opts := &github.PullRequestListOptions{}
 	opts.ListOptions.PerPage = listOptionsPerPage
 	opts.State = "all"
@@ -33,25 +36,35 @@ func (s *PullRequestSyncer) QueueRepository(q queue.Queue, owner, repo string) e
 	logger.Infof("starting to publish queue jobs")
 
 	for {
-		requests, r, err := s.c.PullRequests.List(context.TODO(), owner, repo, opts)
+		requests, r, err := s.c.PullRequests.List(ctx, owner, repo, opts)
 		if err != nil {
 			return err
 		}
 
+		var published int
 		for _, r := range requests {
-			j, err := NewPullRequestSyncJob(owner, repo, r.GetNumber())
+			j, err := NewPullRequestSyncJob(ctx, owner, repo, r.GetNumber(), r.GetUpdatedAt())
 			if err != nil {
 				return err
 			}
 
 			l := logger.With(log.Fields{"pull-request": r.GetNumber()})
 			l.Debugf("queue request")
-			if err := q.Publish(j); err != nil {
+			ok, err := publish(q, j)
+			if err != nil {
 				l.Errorf(err, "publishing job")
-				return nil
+				return p.Published(owner, PullRequestSyncTask, published)
+			}
+
+			if ok {
+				published++
 			}
 		}
 
+		if err := p.Published(owner, PullRequestSyncTask, published); err != nil {
+			return err
+		}
+
 		if r.NextPage == 0 {
 			break
 		}
@@ -64,26 +77,91 @@ func (s *PullRequestSyncer) QueueRepository(q queue.Queue, owner, repo string) e
 	return nil
 }
 
-func (s *PullRequestSyncer) Sync(owner string, repo string, number int) error {
-	pr, _, err := s.c.PullRequests.Get(context.TODO(), owner, repo, number)
+// SyncRepository syncs all the pull requests of a repository and their
+// reviews, without publishing any job to the queue. The reviews are skipped
+// if the reviews syncer is nil.
+func (s *PullRequestSyncer) SyncRepository(ctx context.Context, reviews *PullRequestReviewSyncer, owner, repo string) error {
+	opts := &github.PullRequestListOptions{}
+	opts.ListOptions.PerPage = listOptionsPerPage
+	opts.State = "all"
+
+	for {
+		requests, r, err := s.c.PullRequests.List(ctx, owner, repo, opts)
+		if err != nil {
+			return err
+		}
+
+		for _, pr := range requests {
+			if reviews != nil {
+				if err := reviews.SyncPullRequest(ctx, owner, repo, pr.GetNumber()); err != nil {
+					return err
+				}
+			}
+
+			if err := s.Sync(ctx, owner, repo, pr.GetNumber()); err != nil {
+				return err
+			}
+		}
+
+		if r.NextPage == 0 {
+			break
+		}
+
+		opts.Page = r.NextPage
+	}
+
+	return nil
+}
+
+func (s *PullRequestSyncer) Sync(ctx context.Context, owner string, repo string, number int) error {
+	pr, _, err := s.c.PullRequests.Get(ctx, owner, repo, number)
 	if err != nil {
 		return err
 	}
 
+	return s.doSync(ctx, pr)
+}
+
+// doSyncAll writes the pull requests of a listing page in a single batch.
+func (s *PullRequestSyncer) doSyncAll(ctx context.Context, prs []*github.PullRequest) error {
+	batch := models.NewBatch(models.Schema.PullRequest.BaseSchema)
+	for _, pr := range prs {
+		record := models.NewPullRequest()
+		record.PullRequest = *pr
+
+		if err := batch.Add(record); err != nil {
+			s.stats.Record(utils.PullRequestEntity, utils.Failed, err)
+			return err
+		}
+	}
+
+	return upsert(ctx, s.s.Store, batch, utils.PullRequestEntity, s.stats)
+}
+
+func (s *PullRequestSyncer) doSync(ctx context.Context, pr *github.PullRequest) error {
+	end := utils.StartStoreOp(ctx, "find", utils.PullRequestEntity)
 	record, err := s.s.FindOne(models.NewPullRequestQuery().
 		Where(kallax.And(
 			kallax.Eq(models.Schema.PullRequest.ID, pr.GetID()),
 		)),
 	)
+	end(err)
 	if record == nil {
 		record = models.NewPullRequest()
 		record.PullRequest = *pr
 
-		return s.s.Insert(record)
+		end := utils.StartStoreOp(ctx, "insert", utils.PullRequestEntity)
+		err = s.s.Insert(record)
+		end(err)
+		s.stats.Record(utils.PullRequestEntity, utils.Inserted, err)
+		return err
 	}
 
 	record.PullRequest = *pr
+	end = utils.StartStoreOp(ctx, "update", utils.PullRequestEntity)
 	_, err = s.s.Update(record)
+	end(err)
+	s.stats.Record(utils.PullRequestEntity, utils.Updated, err)
 	return err
 
 }
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
@@ -12,77 +13,117 @@ import (
 )
 
 type PullRequestCommentSyncer struct {
-	s *models.PullRequestCommentStore
-	c *github.Client
+	s     *models.PullRequestCommentStore
+	c     *github.Client
+	stats *utils.Stats
 }
 
-func NewPullRequestCommentSyncer(db *sql.DB, c *github.Client) *PullRequestCommentSyncer {
+func NewPullRequestCommentSyncer(db *sql.DB, c *github.Client, stats *utils.Stats) *PullRequestCommentSyncer {
 	return &PullRequestCommentSyncer{
-		s: models.NewPullRequestCommentStore(db),
-		c: c,
+		s:     models.NewPullRequestCommentStore(db),
+		c:     c,
+		stats: stats,
 	}
 }
 
-func (s *PullRequestCommentSyncer) SyncRepository(owner, repo string) error {
-	return s.SyncPullRequest(owner, repo, 0)
+func (s *PullRequestCommentSyncer) SyncRepository(ctx context.Context, owner, repo string) error {
+	return s.SyncPullRequest(ctx, owner, repo, 0)
 }
 
-func (s *PullRequestCommentSyncer) SyncPullRequest(owner, repo string, number int) error {
-	opts := &github.PullRequestListCommentsOptions{}
-	opts.ListOptions.PerPage = listOptionsPerPage
-
-	logger := log.New(log.Fields{
-		"type":  PullRequestCommentSyncTask,
-		"owner": owner, "repo": repo, "number": number,
-	})
-
+func (s *PullRequestCommentSyncer) SyncPullRequest(ctx context.Context, owner, repo string, number int) error {
+	page := 0
 	for {
-		comments, r, err := s.c.PullRequests.ListComments(context.TODO(), owner, repo, number, opts)
+		r, err := s.syncPage(ctx, owner, repo, number, page)
 		if err != nil {
 			return err
 		}
 
-		for _, c := range comments {
-			if err := s.doSync(c); err != nil {
-				logger.Errorf(err, "issue sync error")
-			}
-		}
-
 		if r.NextPage == 0 {
 			break
 		}
 
-		opts.Page = r.NextPage
+		page = r.NextPage
 	}
 
 	return nil
 }
 
-func (s *PullRequestCommentSyncer) Sync(owner string, repo string, commentID int64) error {
-	comment, _, err := s.c.PullRequests.GetComment(context.TODO(), owner, repo, commentID)
+// SyncPage syncs a page of the review comments of a repository, sorted by
+// creation. The response tells the pages following it.
+func (s *PullRequestCommentSyncer) SyncPage(ctx context.Context, owner, repo string, page int) (*github.Response, error) {
+	return s.syncPage(ctx, owner, repo, 0, page)
+}
+
+func (s *PullRequestCommentSyncer) syncPage(ctx context.Context, owner, repo string, number, page int) (*github.Response, error) {
+	opts := &github.PullRequestListCommentsOptions{Sort: "created", Direction: "asc"}
+	opts.ListOptions.PerPage = listOptionsPerPage
+	opts.Page = page
+
+	logger := log.New(log.Fields{
+		"type":  PullRequestCommentSyncTask,
+		"owner": owner, "repo": repo, "number": number, "page": page,
+	})
+
+	comments, r, err := s.c.PullRequests.ListComments(ctx, owner, repo, number, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s.doSyncAll(ctx, comments, logger)
+	return r, nil
+}
+
+func (s *PullRequestCommentSyncer) Sync(ctx context.Context, owner string, repo string, commentID int64) error {
+	comment, _, err := s.c.PullRequests.GetComment(ctx, owner, repo, commentID)
 	if err != nil {
 		return err
 	}
 
-	return s.doSync(comment)
+	return s.doSync(ctx, comment)
 }
 
-func (s *PullRequestCommentSyncer) doSync(comment *github.PullRequestComment) error {
+// doSyncAll writes the comments of a listing page in a single batch. The
+// comments that can't be written are logged and skipped.
+func (s *PullRequestCommentSyncer) doSyncAll(ctx context.Context, comments []*github.PullRequestComment, logger log.Logger) {
+	batch := models.NewBatch(models.Schema.PullRequestComment.BaseSchema)
+	for _, c := range comments {
+		record := models.NewPullRequestComment()
+		record.PullRequestComment = *c
+
+		if err := batch.Add(record); err != nil {
+			s.stats.Record(utils.CommentEntity, utils.Failed, err)
+			logger.With(log.Fields{"comment": c.GetID()}).Errorf(err, "pull request comment sync error")
+		}
+	}
+
+	upsertOrEach(ctx, s.s.Store, batch, utils.CommentEntity, s.stats, logger)
+}
+
+func (s *PullRequestCommentSyncer) doSync(ctx context.Context, comment *github.PullRequestComment) error {
+	end := utils.StartStoreOp(ctx, "find", utils.CommentEntity)
 	record, err := s.s.FindOne(models.NewPullRequestCommentQuery().
 		Where(kallax.And(
 			kallax.Eq(models.Schema.PullRequestComment.ID, comment.GetID()),
 		)),
 	)
+	end(err)
 
 	if record == nil {
 		record = models.NewPullRequestComment()
 		record.PullRequestComment = *comment
 
-		return s.s.Insert(record)
+		end := utils.StartStoreOp(ctx, "insert", utils.CommentEntity)
+		err = s.s.Insert(record)
+		end(err)
+		s.stats.Record(utils.CommentEntity, utils.Inserted, err)
+		return err
 	}
 
 	record.PullRequestComment = *comment
+	end = utils.StartStoreOp(ctx, "update", utils.CommentEntity)
 	_, err = s.s.Update(record)
+	end(err)
+	s.stats.Record(utils.CommentEntity, utils.Updated, err)
 	return err
 
 }
@@ -0,0 +1,535 @@
+package deep
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+const graphQLPullRequestsPerPage = 25
+
+const graphQLPullRequestsQuery = `
+query($owner: String!, $name: String!, $perPage: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequests(first: $perPage, after: $cursor) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        id
+        databaseId
+        number
+        state
+        locked
+        title
+        body
+        url
+        createdAt
+        updatedAt
+        closedAt
+        mergedAt
+        merged
+        additions
+        deletions
+        changedFiles
+        maintainerCanModify
+        authorAssociation
+        author { ...actor }
+        mergedBy { ...actor }
+        milestone { number title }
+        reviewRequests(first: 100) {
+          pageInfo { hasNextPage }
+          nodes { requestedReviewer { ... on User { login databaseId } } }
+        }
+        headRefName
+        headRefOid
+        headRepository { name owner { login } }
+        headRepositoryOwner { ...actor }
+        baseRefName
+        baseRefOid
+        baseRepository { name owner { login } }
+        commits { totalCount }
+        labels(first: 100) { pageInfo { hasNextPage } nodes { name color } }
+        assignees(first: 100) { pageInfo { hasNextPage } nodes { ...actor } }
+        comments(first: 100) {
+          totalCount
+          pageInfo { hasNextPage endCursor }
+          nodes {` + graphQLIssueCommentFields + `
+          }
+        }
+        reviews(first: 50) {
+          pageInfo { hasNextPage endCursor }
+          nodes {
+            id
+            databaseId
+            state
+            body
+            url
+            submittedAt
+            commit { oid }
+            author { ...actor }
+            comments(first: 50) {
+              pageInfo { hasNextPage endCursor }
+              nodes {
+                id
+                databaseId
+                body
+                path
+                diffHunk
+                position
+                originalPosition
+                url
+                createdAt
+                updatedAt
+                authorAssociation
+                author { ...actor }
+                commit { oid }
+                originalCommit { oid }
+                replyTo { databaseId }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}` + graphQLActorFragment
+
+type graphQLRepositoryRef struct {
+	Name  string `json:"name"`
+	Owner struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+func (r *graphQLRepositoryRef) toRepository() *github.Repository {
+	if r == nil {
+		return nil
+	}
+
+	return &github.Repository{
+		Name:  github.String(r.Name),
+		Owner: &github.User{Login: github.String(r.Owner.Login)},
+	}
+}
+
+type graphQLCommitRef struct {
+	OID string `json:"oid"`
+}
+
+func (c *graphQLCommitRef) sha() *string {
+	if c == nil {
+		return nil
+	}
+
+	return github.String(c.OID)
+}
+
+type graphQLReviewRequests struct {
+	PageInfo graphQLPageInfo `json:"pageInfo"`
+	Nodes    []struct {
+		RequestedReviewer *graphQLActor `json:"requestedReviewer"`
+	} `json:"nodes"`
+}
+
+// toUsers returns the users requested to review, the requested teams are
+// decoded without login and skipped, as the REST API does.
+func (r graphQLReviewRequests) toUsers() []*github.User {
+	var users []*github.User
+	for _, n := range r.Nodes {
+		if n.RequestedReviewer == nil || n.RequestedReviewer.Login == "" {
+			continue
+		}
+
+		users = append(users, n.RequestedReviewer.toUser())
+	}
+
+	return users
+}
+
+type graphQLPullRequest struct {
+	ID                  string                `json:"id"`
+	DatabaseID          int64                 `json:"databaseId"`
+	Number              int                   `json:"number"`
+	State               string                `json:"state"`
+	Locked              bool                  `json:"locked"`
+	Title               string                `json:"title"`
+	Body                string                `json:"body"`
+	URL                 string                `json:"url"`
+	CreatedAt           time.Time             `json:"createdAt"`
+	UpdatedAt           time.Time             `json:"updatedAt"`
+	ClosedAt            *time.Time            `json:"closedAt"`
+	MergedAt            *time.Time            `json:"mergedAt"`
+	Merged              bool                  `json:"merged"`
+	Additions           int                   `json:"additions"`
+	Deletions           int                   `json:"deletions"`
+	ChangedFiles        int                   `json:"changedFiles"`
+	MaintainerCanModify bool                  `json:"maintainerCanModify"`
+	AuthorAssociation   string                `json:"authorAssociation"`
+	Author              *graphQLActor         `json:"author"`
+	MergedBy            *graphQLActor         `json:"mergedBy"`
+	Milestone           *graphQLMilestone     `json:"milestone"`
+	ReviewRequests      graphQLReviewRequests `json:"reviewRequests"`
+	HeadRefName         string                `json:"headRefName"`
+	HeadRefOid          string                `json:"headRefOid"`
+	HeadRepository      *graphQLRepositoryRef `json:"headRepository"`
+	HeadRepositoryOwner *graphQLActor         `json:"headRepositoryOwner"`
+	BaseRefName         string                `json:"baseRefName"`
+	BaseRefOid          string                `json:"baseRefOid"`
+	BaseRepository      *graphQLRepositoryRef `json:"baseRepository"`
+	Commits             struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"commits"`
+	Labels    graphQLLabels `json:"labels"`
+	Assignees graphQLActors `json:"assignees"`
+	Comments  struct {
+		TotalCount int `json:"totalCount"`
+		graphQLIssueComments
+	} `json:"comments"`
+	Reviews struct {
+		PageInfo graphQLPageInfo             `json:"pageInfo"`
+		Nodes    []*graphQLPullRequestReview `json:"nodes"`
+	} `json:"reviews"`
+}
+
+func (pr *graphQLPullRequest) toPullRequest(r *graphQLRepository) *github.PullRequest {
+	labels := pr.Labels.toLabels()
+
+	p := &github.PullRequest{
+		ID:                  github.Int64(pr.DatabaseID),
+		NodeID:              github.String(pr.ID),
+		Number:              github.Int(pr.Number),
+		State:               toState(pr.State),
+		Title:               github.String(pr.Title),
+		Body:                github.String(pr.Body),
+		CreatedAt:           &pr.CreatedAt,
+		UpdatedAt:           &pr.UpdatedAt,
+		ClosedAt:            pr.ClosedAt,
+		MergedAt:            pr.MergedAt,
+		Merged:              github.Bool(pr.Merged),
+		Additions:           github.Int(pr.Additions),
+		Deletions:           github.Int(pr.Deletions),
+		ChangedFiles:        github.Int(pr.ChangedFiles),
+		Commits:             github.Int(pr.Commits.TotalCount),
+		Comments:            github.Int(pr.Comments.TotalCount),
+		MaintainerCanModify: github.Bool(pr.MaintainerCanModify),
+		AuthorAssociation:   github.String(pr.AuthorAssociation),
+		User:                pr.Author.toUser(),
+		MergedBy:            pr.MergedBy.toUser(),
+		Milestone:           pr.Milestone.toMilestone(r),
+		Assignees:           pr.Assignees.toUsers(),
+		RequestedReviewers:  pr.ReviewRequests.toUsers(),
+		URL:                 github.String(r.pullRequestURL(pr.Number)),
+		HTMLURL:             github.String(pr.URL),
+		Head: &github.PullRequestBranch{
+			Ref:  github.String(pr.HeadRefName),
+			SHA:  github.String(pr.HeadRefOid),
+			Repo: pr.HeadRepository.toRepository(),
+			User: pr.HeadRepositoryOwner.toUser(),
+		},
+		Base: &github.PullRequestBranch{
+			Ref:  github.String(pr.BaseRefName),
+			SHA:  github.String(pr.BaseRefOid),
+			Repo: pr.BaseRepository.toRepository(),
+		},
+	}
+
+	// the labels of the branches are prefixed by the owner of their
+	// repository, as the REST API does
+	if owner := pr.HeadRepositoryOwner; owner != nil {
+		p.Head.Label = github.String(owner.Login + ":" + pr.HeadRefName)
+	}
+
+	if repo := pr.BaseRepository; repo != nil {
+		p.Base.Label = github.String(repo.Owner.Login + ":" + pr.BaseRefName)
+		p.Base.User = &github.User{Login: github.String(repo.Owner.Login)}
+	}
+
+	for i := range labels {
+		p.Labels = append(p.Labels, &labels[i])
+	}
+
+	if len(p.Assignees) != 0 {
+		p.Assignee = p.Assignees[0]
+	}
+
+	return p
+}
+
+// truncated returns true if the pull request has more labels, assignees or
+// review requests than the ones retrieved.
+func (pr *graphQLPullRequest) truncated() bool {
+	return pr.Labels.PageInfo.HasNextPage ||
+		pr.Assignees.PageInfo.HasNextPage ||
+		pr.ReviewRequests.PageInfo.HasNextPage
+}
+
+type graphQLPullRequestReview struct {
+	ID          string            `json:"id"`
+	DatabaseID  int64             `json:"databaseId"`
+	State       string            `json:"state"`
+	Body        string            `json:"body"`
+	URL         string            `json:"url"`
+	SubmittedAt *time.Time        `json:"submittedAt"`
+	Commit      *graphQLCommitRef `json:"commit"`
+	Author      *graphQLActor     `json:"author"`
+	Comments    struct {
+		PageInfo graphQLPageInfo                    `json:"pageInfo"`
+		Nodes    []*graphQLPullRequestReviewComment `json:"nodes"`
+	} `json:"comments"`
+}
+
+func (r *graphQLPullRequestReview) toPullRequestReview(prURL string) *github.PullRequestReview {
+	return &github.PullRequestReview{
+		ID:             github.Int64(r.DatabaseID),
+		NodeID:         github.String(r.ID),
+		User:           r.Author.toUser(),
+		Body:           github.String(r.Body),
+		SubmittedAt:    r.SubmittedAt,
+		CommitID:       r.Commit.sha(),
+		HTMLURL:        github.String(r.URL),
+		PullRequestURL: github.String(prURL),
+		State:          github.String(r.State),
+	}
+}
+
+type graphQLPullRequestReviewComment struct {
+	ID                string            `json:"id"`
+	DatabaseID        int64             `json:"databaseId"`
+	Body              string            `json:"body"`
+	Path              string            `json:"path"`
+	DiffHunk          string            `json:"diffHunk"`
+	Position          *int              `json:"position"`
+	OriginalPosition  *int              `json:"originalPosition"`
+	URL               string            `json:"url"`
+	CreatedAt         time.Time         `json:"createdAt"`
+	UpdatedAt         time.Time         `json:"updatedAt"`
+	AuthorAssociation string            `json:"authorAssociation"`
+	Author            *graphQLActor     `json:"author"`
+	Commit            *graphQLCommitRef `json:"commit"`
+	OriginalCommit    *graphQLCommitRef `json:"originalCommit"`
+	ReplyTo           *struct {
+		DatabaseID int64 `json:"databaseId"`
+	} `json:"replyTo"`
+}
+
+func (c *graphQLPullRequestReviewComment) toPullRequestComment(prURL string, reviewID int64) *github.PullRequestComment {
+	comment := &github.PullRequestComment{
+		ID:                  github.Int64(c.DatabaseID),
+		NodeID:              github.String(c.ID),
+		Body:                github.String(c.Body),
+		Path:                github.String(c.Path),
+		DiffHunk:            github.String(c.DiffHunk),
+		PullRequestReviewID: github.Int64(reviewID),
+		Position:            c.Position,
+		OriginalPosition:    c.OriginalPosition,
+		CommitID:            c.Commit.sha(),
+		OriginalCommitID:    c.OriginalCommit.sha(),
+		User:                c.Author.toUser(),
+		CreatedAt:           &c.CreatedAt,
+		UpdatedAt:           &c.UpdatedAt,
+		AuthorAssociation:   github.String(c.AuthorAssociation),
+		HTMLURL:             github.String(c.URL),
+		PullRequestURL:      github.String(prURL),
+	}
+
+	if c.ReplyTo != nil {
+		comment.InReplyTo = github.Int64(c.ReplyTo.DatabaseID)
+	}
+
+	return comment
+}
+
+// SyncRepositoryGraphQL retrieves all the pull requests of a repository,
+// including their reviews and comments, using the GraphQL API. The pull
+// requests with more labels, assignees or review requests than the ones
+// retrieved in a single query, and the reviews and comments of the ones with
+// more of them, are retrieved using the REST API. The reviews and comments of
+// the syncers given as nil are skipped.
+func (s *PullRequestSyncer) SyncRepositoryGraphQL(
+	ctx context.Context,
+	reviews *PullRequestReviewSyncer,
+	comments *PullRequestCommentSyncer,
+	issueComments *IssueCommentsSyncer,
+	owner, repo string,
+) error {
+	logger := log.New(log.Fields{"type": PullRequestSyncTask, "owner": owner, "repo": repo, "api": GraphQLAPI})
+	logger.Infof("starting to retrieve pull requests")
+
+	vars := map[string]interface{}{
+		"owner":   owner,
+		"name":    repo,
+		"perPage": graphQLPullRequestsPerPage,
+		"cursor":  nil,
+	}
+
+	r, err := newGraphQLRepository(ctx, s.c, owner, repo)
+	if err != nil {
+		return err
+	}
+
+	for {
+		var data struct {
+			Repository struct {
+				PullRequests struct {
+					PageInfo graphQLPageInfo       `json:"pageInfo"`
+					Nodes    []*graphQLPullRequest `json:"nodes"`
+				} `json:"pullRequests"`
+			} `json:"repository"`
+		}
+
+		if err := queryGraphQL(ctx, s.c, graphQLPullRequestsQuery, vars, &data); err != nil {
+			return err
+		}
+
+		prs := data.Repository.PullRequests
+		page := make([]*github.PullRequest, len(prs.Nodes))
+		for n, pr := range prs.Nodes {
+			if !pr.truncated() {
+				page[n] = pr.toPullRequest(r)
+				continue
+			}
+
+			logger.With(log.Fields{"pull-request": pr.Number}).Debugf("too many labels, assignees or review requests, falling back to REST")
+			p, _, err := s.c.PullRequests.Get(ctx, owner, repo, pr.Number)
+			if err != nil {
+				return err
+			}
+
+			page[n] = p
+		}
+
+		if err := s.doSyncAll(ctx, page); err != nil {
+			return err
+		}
+
+		if issueComments != nil {
+			if err := s.syncGraphQLComments(ctx, issueComments, r, prs.Nodes, logger); err != nil {
+				return err
+			}
+		}
+
+		if reviews != nil {
+			if err := s.syncGraphQLReviews(ctx, reviews, comments, r, prs.Nodes, logger); err != nil {
+				return err
+			}
+		}
+
+		if !prs.PageInfo.HasNextPage {
+			break
+		}
+
+		vars["cursor"] = prs.PageInfo.EndCursor
+	}
+
+	logger.Infof("finished to retrieve pull requests")
+
+	return nil
+}
+
+// syncGraphQLComments writes the issue comments retrieved along with a page
+// of pull requests in a single batch, as the ones of the issues. The comments
+// of the pull requests with more of them than retrieved are synced with the
+// REST API.
+func (s *PullRequestSyncer) syncGraphQLComments(
+	ctx context.Context,
+	issueComments *IssueCommentsSyncer,
+	r *graphQLRepository,
+	prs []*graphQLPullRequest,
+	logger log.Logger,
+) error {
+	var page []*github.IssueComment
+	for _, pr := range prs {
+		if pr.Comments.PageInfo.HasNextPage {
+			logger.With(log.Fields{"pull-request": pr.Number}).Debugf("too many comments, falling back to REST")
+			if err := issueComments.SyncIssue(ctx, r.owner, r.name, pr.Number); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		for _, c := range pr.Comments.Nodes {
+			page = append(page, c.toIssueComment(r.issueURL(pr.Number)))
+		}
+	}
+
+	issueComments.doSyncAll(ctx, page, logger)
+	return nil
+}
+
+// syncGraphQLReviews writes the reviews retrieved along with a page of pull
+// requests in a single batch, and their comments in another one. The reviews
+// of the pull requests with more of them than retrieved, and the review
+// comments of the ones with a review with more of them, are synced with the
+// REST API. The review comments are skipped if the comments syncer is nil.
+func (s *PullRequestSyncer) syncGraphQLReviews(
+	ctx context.Context,
+	reviews *PullRequestReviewSyncer,
+	comments *PullRequestCommentSyncer,
+	r *graphQLRepository,
+	prs []*graphQLPullRequest,
+	logger log.Logger,
+) error {
+	var (
+		reviewsPage  []*github.PullRequestReview
+		commentsPage []*github.PullRequestComment
+		fallback     []int
+	)
+
+	for _, pr := range prs {
+		if pr.Reviews.PageInfo.HasNextPage {
+			logger.With(log.Fields{"pull-request": pr.Number}).Debugf("too many reviews, falling back to REST")
+			if err := reviews.SyncPullRequest(ctx, r.owner, r.name, pr.Number); err != nil {
+				return err
+			}
+
+			if comments != nil {
+				fallback = append(fallback, pr.Number)
+			}
+
+			continue
+		}
+
+		prURL := r.pullRequestURL(pr.Number)
+
+		var truncated bool
+		for _, review := range pr.Reviews.Nodes {
+			reviewsPage = append(reviewsPage, review.toPullRequestReview(prURL))
+			if comments == nil || truncated {
+				continue
+			}
+
+			if review.Comments.PageInfo.HasNextPage {
+				truncated = true
+				continue
+			}
+
+			for _, c := range review.Comments.Nodes {
+				commentsPage = append(commentsPage, c.toPullRequestComment(prURL, review.DatabaseID))
+			}
+		}
+
+		if truncated {
+			logger.With(log.Fields{"pull-request": pr.Number}).Debugf("too many review comments, falling back to REST")
+			fallback = append(fallback, pr.Number)
+		}
+	}
+
+	if err := reviews.doSyncAll(ctx, reviewsPage); err != nil {
+		return err
+	}
+
+	if comments == nil {
+		return nil
+	}
+
+	comments.doSyncAll(ctx, commentsPage, logger)
+	for _, number := range fallback {
+		if err := comments.SyncPullRequest(ctx, r.owner, r.name, number); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -5,37 +5,38 @@ import (
 	"database/sql"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
 )
 
 type PullRequestReviewSyncer struct {
-	s *models.PullRequestReviewStore
-	c *github.Client
+	s     *models.PullRequestReviewStore
+	c     *github.Client
+	stats *utils.Stats
 }
 
-func NewPullRequestReviewSyncer(db *sql.DB, c *github.Client) *PullRequestReviewSyncer {
+func NewPullRequestReviewSyncer(db *sql.DB, c *github.Client, stats *utils.Stats) *PullRequestReviewSyncer {
 	return &PullRequestReviewSyncer{
-		s: models.NewPullRequestReviewStore(db),
-		c: c,
+		s:     models.NewPullRequestReviewStore(db),
+		c:     c,
+		stats: stats,
 	}
 }
 
-func (s *PullRequestReviewSyncer) SyncPullRequest(owner, repo string, number int) error {
+func (s *PullRequestReviewSyncer) SyncPullRequest(ctx context.Context, owner, repo string, number int) error {
 	opts := &github.ListOptions{}
 	opts.PerPage = listOptionsPerPage
 
 	for {
-		reviews, r, err := s.c.PullRequests.ListReviews(context.TODO(), owner, repo, number, opts)
+		reviews, r, err := s.c.PullRequests.ListReviews(ctx, owner, repo, number, opts)
 		if err != nil {
 			return err
 		}
 
-		for _, r := range reviews {
-			if err := s.doSync(r); err != nil {
-				return err
-			}
+		if err := s.doSyncAll(ctx, reviews); err != nil {
+			return err
 		}
 
 		if r.NextPage == 0 {
@@ -48,30 +49,55 @@ func (s *PullRequestReviewSyncer) SyncPullRequest(owner, repo string, number int
 	return nil
 }
 
-func (s *PullRequestReviewSyncer) Sync(owner string, repo string, number int, reviewID int64) error {
-	review, _, err := s.c.PullRequests.GetReview(context.TODO(), owner, repo, number, reviewID)
+func (s *PullRequestReviewSyncer) Sync(ctx context.Context, owner string, repo string, number int, reviewID int64) error {
+	review, _, err := s.c.PullRequests.GetReview(ctx, owner, repo, number, reviewID)
 	if err != nil {
 		return err
 	}
 
-	return s.doSync(review)
+	return s.doSync(ctx, review)
 }
 
-func (s *PullRequestReviewSyncer) doSync(review *github.PullRequestReview) error {
+// doSyncAll writes the reviews of a listing page in a single batch.
+func (s *PullRequestReviewSyncer) doSyncAll(ctx context.Context, reviews []*github.PullRequestReview) error {
+	batch := models.NewBatch(models.Schema.PullRequestReview.BaseSchema)
+	for _, r := range reviews {
+		record := models.NewPullRequestReview()
+		record.PullRequestReview = *r
+
+		if err := batch.Add(record); err != nil {
+			s.stats.Record(utils.ReviewEntity, utils.Failed, err)
+			return err
+		}
+	}
+
+	return upsert(ctx, s.s.Store, batch, utils.ReviewEntity, s.stats)
+}
+
+func (s *PullRequestReviewSyncer) doSync(ctx context.Context, review *github.PullRequestReview) error {
+	end := utils.StartStoreOp(ctx, "find", utils.ReviewEntity)
 	record, err := s.s.FindOne(models.NewPullRequestReviewQuery().
 		Where(kallax.And(
 			kallax.Eq(models.Schema.PullRequestReview.ID, review.GetID()),
 		)),
 	)
+	end(err)
 	if record == nil {
 		record = models.NewPullRequestReview()
 		record.PullRequestReview = *review
 
-		return s.s.Insert(record)
+		end := utils.StartStoreOp(ctx, "insert", utils.ReviewEntity)
+		err = s.s.Insert(record)
+		end(err)
+		s.stats.Record(utils.ReviewEntity, utils.Inserted, err)
+		return err
 	}
 
 	record.PullRequestReview = *review
+	end = utils.StartStoreOp(ctx, "update", utils.ReviewEntity)
 	_, err = s.s.Update(record)
+	end(err)
+	s.stats.Record(utils.ReviewEntity, utils.Updated, err)
 	return err
 
 }
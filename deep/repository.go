@@ -5,6 +5,7 @@ import (
 	"database/sql"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
@@ -13,40 +14,84 @@ import (
 )
 
 type RepositorySyncer struct {
-	s *models.RepositoryStore
-	c *github.Client
+	s     *models.RepositoryStore
+	c     *github.Client
+	stats *utils.Stats
+
+	// Filter selects the repositories to publish jobs for, all of them if
+	// it's nil. The jobs requested with their own filter use that instead
+	Filter *utils.RepositoryFilter
 }
 
-func NewRepositorySyncer(db *sql.DB, c *github.Client) *RepositorySyncer {
+func NewRepositorySyncer(db *sql.DB, c *github.Client, stats *utils.Stats) *RepositorySyncer {
 	return &RepositorySyncer{
-		s: models.NewRepositoryStore(db),
-		c: c,
+		s:     models.NewRepositoryStore(db),
+		c:     c,
+		stats: stats,
 	}
 }
 
-func (s *RepositorySyncer) QueueOrganization(q queue.Queue, owner string) error {
-	opts := &github.RepositoryListByOrgOptions{}
-	opts.ListOptions.PerPage = listOptionsPerPage
+type listRepositoriesFunc func(ctx context.Context, owner string, opts github.ListOptions) ([]*github.Repository, *github.Response, error)
+
+// QueueOrganization publishes a job for each repository of an organization.
+func (s *RepositorySyncer) QueueOrganization(ctx context.Context, q queue.Queue, p *Progress, owner string) error {
+	return s.queue(ctx, q, p, owner, s.listByOrg)
+}
+
+// QueueUser publishes a job for each repository owned by a user account.
+func (s *RepositorySyncer) QueueUser(ctx context.Context, q queue.Queue, p *Progress, login string) error {
+	return s.queue(ctx, q, p, login, s.listByUser)
+}
+
+func (s *RepositorySyncer) listByOrg(ctx context.Context, owner string, opts github.ListOptions) ([]*github.Repository, *github.Response, error) {
+	return s.c.Repositories.ListByOrg(ctx, owner,
+		&github.RepositoryListByOrgOptions{ListOptions: opts})
+}
+
+func (s *RepositorySyncer) listByUser(ctx context.Context, owner string, opts github.ListOptions) ([]*github.Repository, *github.Response, error) {
+	return s.c.Repositories.List(ctx, owner,
+		&github.RepositoryListOptions{Type: "owner", ListOptions: opts})
+}
+
+func (s *RepositorySyncer) queue(ctx context.Context, q queue.Queue, p *Progress, owner string, list listRepositoriesFunc) error {
+	opts := github.ListOptions{}
+	opts.PerPage = listOptionsPerPage
 
 	logger := log.New(log.Fields{"type": RepositorySyncTask, "owner": owner})
 	logger.Infof("starting to publish queue jobs")
 
+	filter := s.filter(ctx)
 	for {
-		repositories, r, err := s.c.Repositories.ListByOrg(context.TODO(), owner, opts)
+		repositories, r, err := list(ctx, owner, opts)
 		if err != nil {
 			return err
 		}
 
+		var published int
 		for _, r := range repositories {
-			j, err := NewRepositorySyncJob(owner, r.GetName())
+			if !filter.Match(r) {
+				logger.With(log.Fields{"repo": r.GetName()}).Debugf("repository filtered out, skipping")
+				continue
+			}
+
+			j, err := NewRepositorySyncJob(ctx, owner, r.GetName(), r.GetUpdatedAt().Time)
 			if err != nil {
 				return err
 			}
 
 			logger.With(log.Fields{"repo": r.GetName()}).Debugf("queue request")
-			if err := q.Publish(j); err != nil {
+			ok, err := publish(q, j)
+			if err != nil {
 				return err
 			}
+
+			if ok {
+				published++
+			}
+		}
+
+		if err := p.Published(owner, RepositorySyncTask, published); err != nil {
+			return err
 		}
 
 		if r.NextPage == 0 {
@@ -61,25 +106,34 @@ func (s *RepositorySyncer) QueueOrganization(q queue.Queue, owner string) error
 	return nil
 }
 
-func (s *RepositorySyncer) Sync(owner, name string) error {
-	repository, _, err := s.c.Repositories.Get(context.TODO(), owner, name)
+func (s *RepositorySyncer) Sync(ctx context.Context, owner, name string) error {
+	repository, _, err := s.c.Repositories.Get(ctx, owner, name)
 	if err != nil {
 		return err
 	}
 
+	end := utils.StartStoreOp(ctx, "find", utils.RepositoryEntity)
 	record, err := s.s.FindOne(models.NewRepositoryQuery().
 		Where(kallax.Eq(models.Schema.Repository.ID, repository.GetID())),
 	)
+	end(err)
 
 	if record == nil {
 		record = models.NewRepository()
 		record.Repository = *repository
 
-		return s.s.Insert(record)
+		end := utils.StartStoreOp(ctx, "insert", utils.RepositoryEntity)
+		err = s.s.Insert(record)
+		end(err)
+		s.stats.Record(utils.RepositoryEntity, utils.Inserted, err)
+		return err
 	}
 
 	record.Repository = *repository
+	end = utils.StartStoreOp(ctx, "update", utils.RepositoryEntity)
 	_, err = s.s.Update(record)
+	end(err)
+	s.stats.Record(utils.RepositoryEntity, utils.Updated, err)
 	return err
 
 }
@@ -1,17 +1,43 @@
 package deep
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sync"
+	"time"
+
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/src-d/go-log.v1"
 	"gopkg.in/src-d/go-queue.v1"
 )
 
 type Syncer struct {
-	c *github.Client
-	q queue.Queue
+	c     *github.Client
+	q     queue.Queue
+	stats *utils.Stats
+
+	m          sync.Mutex
+	lastJob    time.Time
+	runningJob time.Time
+
+	// API is the API used to retrieve each entity, REST is used for the
+	// entities not present. The jobs requested with their own API use that
+	// instead
+	API map[SyncTaskType]API
+	// Entities are the entities synced, all of them are synced if it's nil.
+	// The jobs requested with their own entities sync those instead
+	Entities utils.Entities
+	// Progress tracks the jobs published and handled, nothing is tracked if
+	// it's nil
+	Progress *Progress
+	// Dedup skips the jobs already pending or handled recently, no job is
+	// skipped if it's nil
+	Dedup *Dedup
 
 	Organization       *OrganizationSyncer
 	User               *UserSyncer
@@ -23,56 +49,183 @@ type Syncer struct {
 	PullRequestReview  *PullRequestReviewSyncer
 }
 
-func NewSyncer(db *sql.DB, c *github.Client, q queue.Queue) *Syncer {
+// NewSyncer returns a new Syncer. The outcome of the resources synced is
+// recorded in stats, that can be nil.
+func NewSyncer(db *sql.DB, c *github.Client, q queue.Queue, stats *utils.Stats) *Syncer {
 	return &Syncer{
-		c: c,
-		q: q,
+		c:     c,
+		q:     q,
+		stats: stats,
 
-		Organization:       NewOrganizationSyncer(db, c),
-		User:               NewUserSyncer(db, c),
-		Repository:         NewRepositorySyncer(db, c),
-		Issues:             NewIssueSyncer(db, c),
-		IssueComment:       NewIssueCommentsSyncer(db, c),
-		PullRequest:        NewPullRequestSyncer(db, c),
-		PullRequestComment: NewPullRequestCommentSyncer(db, c),
-		PullRequestReview:  NewPullRequestReviewSyncer(db, c),
+		Organization:       NewOrganizationSyncer(db, c, stats),
+		User:               NewUserSyncer(db, c, stats),
+		Repository:         NewRepositorySyncer(db, c, stats),
+		Issues:             NewIssueSyncer(db, c, stats),
+		IssueComment:       NewIssueCommentsSyncer(db, c, stats),
+		PullRequest:        NewPullRequestSyncer(db, c, stats),
+		PullRequestComment: NewPullRequestCommentSyncer(db, c, stats),
+		PullRequestReview:  NewPullRequestReviewSyncer(db, c, stats),
 	}
 }
 
-func (s *Syncer) DoOrganization(org string) error {
-	if err := s.Organization.Sync(org); err != nil {
+// DoOrganization syncs an organization and publishes the jobs for its
+// repositories and members. If the login belongs to a user account, the user
+// is synced and only the jobs for its repositories are published.
+func (s *Syncer) DoOrganization(ctx context.Context, org string) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "deep.organization",
+		trace.WithAttributes(attribute.String("ghsync.org", org)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if err := s.Progress.Reset(org); err != nil {
 		return err
 	}
 
-	if err := s.Repository.QueueOrganization(s.q, org); err != nil {
+	return s.doOrganization(ctx, org)
+}
+
+// QueueOrganization publishes the job of an organization, so it's synced by
+// the worker that handles it, like DoOrganization does.
+func (s *Syncer) QueueOrganization(ctx context.Context, org string) error {
+	j, err := NewOrganizationSyncJob(ctx, org)
+	if err != nil {
 		return err
 	}
 
-	if err := s.User.QueueOrganization(s.q, org); err != nil {
+	// the progress is reset along with the publication, not after it, or
+	// the counts of a worker handling the job right away would be cleared
+	return s.Progress.Restart(org, func() (bool, error) {
+		return publish(s.publisher(), j)
+	})
+}
+
+func (s *Syncer) doOrganization(ctx context.Context, org string) error {
+	owner, _, err := s.c.Users.Get(ctx, org)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	if owner.GetType() == userOwnerType {
+		if s.entities(ctx).Has(utils.UserEntity) {
+			if err := s.User.Sync(ctx, org); err != nil {
+				return err
+			}
+		}
+
+		return s.Repository.QueueUser(ctx, s.publisher(), s.Progress, org)
+	}
+
+	if s.entities(ctx).Has(utils.OrganizationEntity) {
+		if err := s.Organization.Sync(ctx, org); err != nil {
+			return err
+		}
+	}
+
+	if err := s.Repository.QueueOrganization(ctx, s.publisher(), s.Progress, org); err != nil {
+		return err
+	}
+
+	if !s.entities(ctx).Has(utils.UserEntity) {
+		return nil
+	}
+
+	return s.User.QueueOrganization(ctx, s.publisher(), s.Progress, org)
+}
+
+// QueueRepository publishes the job of a single repository.
+func (s *Syncer) QueueRepository(ctx context.Context, owner, name string) error {
+	j, err := NewRepositorySyncJob(ctx, owner, name, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	return s.publishJob(owner, RepositorySyncTask, j)
 }
 
-func (s *Syncer) Wait() error {
+// QueueIssue publishes the job of a single issue.
+func (s *Syncer) QueueIssue(ctx context.Context, owner, name string, number int) error {
+	j, err := NewIssueSyncJob(ctx, owner, name, number, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	return s.publishJob(owner, IssueSyncTask, j)
+}
+
+// QueuePullRequest publishes the job of a single pull request.
+func (s *Syncer) QueuePullRequest(ctx context.Context, owner, name string, number int) error {
+	j, err := NewPullRequestSyncJob(ctx, owner, name, number, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	return s.publishJob(owner, PullRequestSyncTask, j)
+}
+
+// publishJob publishes a job of the organization, it's counted in its
+// progress unless it's skipped as duplicated.
+func (s *Syncer) publishJob(org string, t SyncTaskType, j *queue.Job) error {
+	ok, err := publish(s.publisher(), j)
+	if err != nil || !ok {
+		return err
+	}
+
+	return s.Progress.Published(org, t, 1)
+}
+
+// publisher returns the queue to publish the jobs to, that skips the
+// duplicated jobs if Dedup is set.
+func (s *Syncer) publisher() queue.Queue {
+	if s.Dedup == nil {
+		return s.q
+	}
+
+	return &dedupQueue{Queue: s.q, d: s.Dedup}
+}
+
+// Wait handles the jobs of the queue until ctx is cancelled or the queue
+// fails. The job in progress is cancelled too, it's rejected to put it back
+// in the queue so it's handled again.
+func (s *Syncer) Wait(ctx context.Context) error {
 	iter, err := s.q.Consume(1)
 	if err != nil {
 		return err
 	}
+	defer iter.Close()
 
+	jobs, errs := nextJobs(ctx, iter)
 	for {
-		j, err := iter.Next()
-		if err != nil {
+		var j *queue.Job
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
 			return err
+		case j = <-jobs:
 		}
 
-		var task *SyncTasks
-		if err := j.Decode(&task); err != nil {
-			return err
+		task, payload, err := decodeJob(j)
+		if err != nil {
+			if task != nil {
+				if err := s.Dedup.Handled(task.Key, err); err != nil {
+					log.Errorf(err, "error releasing the job key")
+				}
+			}
+
+			if err := deadLetter(j, task, err); err != nil {
+				return err
+			}
+
+			continue
 		}
 
-		if err := s.handleSyncTasks(task); err != nil {
+		// the jobs published while handling the job go to its lane, with its
+		// options
+		jobCtx := WithOptions(WithLane(ctx, jobLane(j.Priority)), task.Options)
+		if err := s.handleSyncTasks(jobCtx, task, payload); err != nil {
+			if err := j.Reject(true); err != nil {
+				return err
+			}
+
 			return err
 		}
 
@@ -80,74 +233,458 @@ func (s *Syncer) Wait() error {
 			return err
 		}
 	}
-
-	return nil
 }
 
-func (s *Syncer) handleSyncTasks(task *SyncTasks) error {
-	payload := task.Payload.(map[interface{}]interface{})
+// nextJobs reads the jobs of iter in the background, so waiting for them can
+// be interrupted. It stops when ctx is done or iter fails.
+func nextJobs(ctx context.Context, iter queue.JobIter) (<-chan *queue.Job, <-chan error) {
+	jobs := make(chan *queue.Job)
+	errs := make(chan error, 1)
+
+	go func() {
+		for {
+			j, err := iter.Next()
+			if err != nil {
+				errs <- err
+				return
+			}
 
-	logger := log.New(log.Fields{"type": task.Type}).New(logFieldsFromPayload(payload))
+			select {
+			case jobs <- j:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return jobs, errs
+}
+
+// handleSyncTasks handles a job. The errors of the job are logged and
+// recorded, an error is only returned if it was interrupted because ctx was
+// cancelled.
+func (s *Syncer) handleSyncTasks(ctx context.Context, task *SyncTasks, payload Payload) error {
+	fields := payload.Fields()
+	logger := log.New(log.Fields{"type": task.Type, "lane": laneFromContext(ctx)}).New(fields)
 	logger.Infof("handling request")
 
-	if err := s.doHandleSyncTasks(logger, task); err != nil {
+	ctx, span := startJobSpan(ctx, task, fields)
+
+	start := s.jobStarted()
+	err := s.doHandleSyncTasks(ctx, task.Type, payload)
+	utils.EndSpan(span, err)
+	if err != nil && ctx.Err() != nil {
+		s.jobHandled(false)
+		logger.Warningf("request interrupted, it will be handled again")
+		return ctx.Err()
+	}
+
+	observeJob(task.Type, start, err)
+	s.jobHandled(true)
+	if err != nil {
 		logger.Errorf(err, "error handling request")
-		return nil
+	}
+
+	if err := s.Progress.Handled(progressOrg(fields), task.Type, err); err != nil {
+		logger.Errorf(err, "error updating progress")
+	}
+
+	if err := s.Dedup.Handled(task.Key, err); err != nil {
+		logger.Errorf(err, "error recording the job as handled")
 	}
 
 	return nil
 }
 
-func (s *Syncer) doHandleSyncTasks(logger log.Logger, task *SyncTasks) error {
-	payload := task.Payload.(map[interface{}]interface{})
+func (s *Syncer) jobStarted() time.Time {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.runningJob = time.Now()
+	return s.runningJob
+}
+
+func (s *Syncer) jobHandled(finished bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.runningJob = time.Time{}
+	if finished {
+		s.lastJob = time.Now()
+	}
+}
+
+// LastJob returns when the last job was handled, it's zero if no job has been
+// handled yet.
+func (s *Syncer) LastJob() time.Time {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.lastJob
+}
+
+// RunningJob returns when the job being handled started, it's zero if no job
+// is being handled.
+func (s *Syncer) RunningJob() time.Time {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.runningJob
+}
+
+// LastProgress returns when the job being handled last made progress, a
+// resource synced or a GitHub API call, it's zero if no job is being handled.
+func (s *Syncer) LastProgress() time.Time {
+	running := s.RunningJob()
+	if running.IsZero() {
+		return running
+	}
+
+	if last := s.stats.LastProgress(); last.After(running) {
+		return last
+	}
+
+	return running
+}
 
-	switch task.Type {
-	case RepositorySyncTask:
-		owner, name := payload["Owner"].(string), payload["Name"].(string)
-		if err := s.Issues.QueueRepository(s.q, owner, name); err != nil {
+// startJobSpan starts the span of a job as a child of the span that
+// published it. Every repository job starts a new trace instead, linked to
+// the organization sync, so the size of the traces doesn't depend on the
+// size of the organization.
+func startJobSpan(ctx context.Context, task *SyncTasks, fields log.Fields) (context.Context, trace.Span) {
+	ctx = task.context(ctx)
+
+	attrs := []attribute.KeyValue{attribute.String("ghsync.type", string(task.Type))}
+	for k, v := range fields {
+		attrs = append(attrs, attribute.String("ghsync."+k, fmt.Sprint(v)))
+	}
+
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+	}
+
+	if task.Type == RepositorySyncTask {
+		opts = append(opts, trace.WithNewRoot(), trace.WithLinks(trace.LinkFromContext(ctx)))
+	}
+
+	return utils.Tracer().Start(ctx, "deep.job "+string(task.Type), opts...)
+}
+
+// progressOrg returns the organization a job is tracked for, given the
+// fields of its payload.
+func progressOrg(fields log.Fields) string {
+	for _, k := range []string{"org", "owner", "login"} {
+		if v, _ := fields[k].(string); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func (s *Syncer) doHandleSyncTasks(ctx context.Context, t SyncTaskType, payload Payload) error {
+	switch p := payload.(type) {
+	case *OrganizationSyncPayload:
+		return s.doOrganization(ctx, p.Org)
+	case *RepositorySyncPayload:
+		if err := s.doIssues(ctx, p.Owner, p.Name); err != nil {
 			return err
 		}
 
-		if err := s.PullRequest.QueueRepository(s.q, owner, name); err != nil {
+		if err := s.doPullRequests(ctx, p.Owner, p.Name); err != nil {
 			return err
 		}
 
-		if err := s.PullRequestComment.SyncRepository(owner, name); err != nil {
+		if err := s.queueComments(ctx, p.Owner, p.Name); err != nil {
 			return err
 		}
 
-		if err := s.IssueComment.SyncRepository(owner, name); err != nil {
+		return s.doRepository(ctx, p.Owner, p.Name)
+	case *UserSyncPayload:
+		return s.User.Sync(ctx, p.Login)
+	case *IssueSyncPayload:
+		if t == IssueSyncTask {
+			return s.Issues.Sync(ctx, p.Owner, p.Name, int(p.Number))
+		}
+
+		if s.entities(ctx).Has(utils.ReviewEntity) {
+			if err := s.PullRequestReview.SyncPullRequest(ctx, p.Owner, p.Name, int(p.Number)); err != nil {
+				return err
+			}
+		}
+
+		return s.PullRequest.Sync(ctx, p.Owner, p.Name, int(p.Number))
+
+	// Obsolote?
+	case *IssueCommentSyncPayload:
+		if t == IssueCommentSyncTask {
+			return s.IssueComment.Sync(ctx, p.Owner, p.Name, int64(p.CommentID))
+		}
+
+		return s.PullRequestComment.Sync(ctx, p.Owner, p.Name, int64(p.CommentID))
+	case *PullRequestReviewSyncPayload:
+		return s.PullRequestReview.Sync(ctx, p.Owner, p.Name, int(p.Number), int64(p.ReviewID))
+	case *CommentPageSyncPayload:
+		return s.doCommentPage(ctx, t, p)
+	}
+
+	return fmt.Errorf("unexpected tasks: %s", t)
+}
+
+func (s *Syncer) doIssues(ctx context.Context, owner, name string) error {
+	if !s.entities(ctx).Has(utils.IssueEntity) {
+		return nil
+	}
+
+	if s.api(ctx, IssueSyncTask) == GraphQLAPI {
+		return s.Issues.SyncRepositoryGraphQL(ctx, s.issueComments(ctx), owner, name)
+	}
+
+	return s.Issues.QueueRepository(ctx, s.publisher(), s.Progress, owner, name)
+}
+
+func (s *Syncer) doPullRequests(ctx context.Context, owner, name string) error {
+	if !s.entities(ctx).Has(utils.PullRequestEntity) {
+		return nil
+	}
+
+	if s.api(ctx, PullRequestSyncTask) == GraphQLAPI {
+		return s.PullRequest.SyncRepositoryGraphQL(ctx,
+			s.pullRequestReviews(ctx), s.pullRequestComments(ctx), s.issueComments(ctx), owner, name)
+	}
+
+	return s.PullRequest.QueueRepository(ctx, s.publisher(), s.Progress, owner, name)
+}
+
+// commentTasks returns the comment page tasks needed to sync the comments of
+// a repository.
+func (s *Syncer) commentTasks(ctx context.Context) []SyncTaskType {
+	if !s.entities(ctx).Has(utils.CommentEntity) {
+		return nil
+	}
+
+	// the comments are retrieved along with their issues and pull requests
+	// when GraphQL is used
+	prGraphQL := s.api(ctx, PullRequestSyncTask) == GraphQLAPI && s.entities(ctx).Has(utils.PullRequestEntity)
+	issueGraphQL := s.api(ctx, IssueSyncTask) == GraphQLAPI && s.entities(ctx).Has(utils.IssueEntity)
+
+	var tasks []SyncTaskType
+	if !prGraphQL {
+		tasks = append(tasks, PullRequestCommentPageSyncTask)
+	}
+
+	if !issueGraphQL || !prGraphQL {
+		tasks = append(tasks, IssueCommentPageSyncTask)
+	}
+
+	return tasks
+}
+
+func (s *Syncer) doComments(ctx context.Context, owner, name string) error {
+	for _, t := range s.commentTasks(ctx) {
+		var err error
+		if t == PullRequestCommentPageSyncTask {
+			err = s.PullRequestComment.SyncRepository(ctx, owner, name)
+		} else {
+			err = s.IssueComment.SyncRepository(ctx, owner, name)
+		}
+
+		if err != nil {
 			return err
 		}
+	}
 
-		return s.Repository.Sync(owner, name)
-	case UserSyncTask:
-		login := payload["Login"].(string)
-		return s.User.Sync(login)
-	case IssueSyncTask:
-		owner, name, number := payload["Owner"].(string), payload["Name"].(string), toInt(payload["Number"])
-		return s.Issues.Sync(owner, name, int(number))
-	case PullRequestSyncTask:
-		owner, name, number := payload["Owner"].(string), payload["Name"].(string), toInt(payload["Number"])
+	return nil
+}
 
-		if err := s.PullRequestReview.SyncPullRequest(owner, name, number); err != nil {
+// queueComments publishes the jobs of the first page of the comments of a
+// repository, instead of syncing them all within the repository job.
+func (s *Syncer) queueComments(ctx context.Context, owner, name string) error {
+	for _, t := range s.commentTasks(ctx) {
+		if err := s.queueCommentPage(ctx, t, owner, name, 1, true); err != nil {
 			return err
 		}
+	}
 
-		return s.PullRequest.Sync(owner, name, int(number))
+	return nil
+}
 
-	// Obsolote?
-	case IssueCommentSyncTask:
-		owner, name, id := payload["Owner"].(string), payload["Name"].(string), toInt(payload["CommentID"])
-		return s.IssueComment.Sync(owner, name, int64(id))
-	case PullRequestCommentSyncTask:
-		owner, name, id := payload["Owner"].(string), payload["Name"].(string), toInt(payload["CommentID"])
-		return s.PullRequestComment.Sync(owner, name, int64(id))
-	case PullRequestReviewSyncTask:
-		owner, name := payload["Owner"].(string), payload["Name"].(string)
-		number, id := toInt(payload["Number"]), toInt(payload["ReviewID"])
-		return s.PullRequestReview.Sync(owner, name, int(number), int64(id))
-	}
-
-	return fmt.Errorf("unexpected tasks: %s", task.Type)
+// doCommentPage syncs a page of comments and publishes the jobs of the pages
+// following it: the first page publishes all the pages known, and the last
+// one the page added since, if any.
+func (s *Syncer) doCommentPage(ctx context.Context, t SyncTaskType, p *CommentPageSyncPayload) error {
+	syncPage := s.IssueComment.SyncPage
+	if t == PullRequestCommentPageSyncTask {
+		syncPage = s.PullRequestComment.SyncPage
+	}
+
+	r, err := syncPage(ctx, p.Owner, p.Name, int(p.Page))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case p.Page == 1 && r.LastPage > 1:
+		for page := 2; page <= r.LastPage; page++ {
+			err := s.queueCommentPage(ctx, t, p.Owner, p.Name, page, page == r.LastPage)
+			if err != nil {
+				return err
+			}
+		}
+	case p.Last && r.NextPage != 0:
+		return s.queueCommentPage(ctx, t, p.Owner, p.Name, r.NextPage, true)
+	}
+
+	return nil
+}
+
+func (s *Syncer) queueCommentPage(ctx context.Context, t SyncTaskType, owner, name string, page int, last bool) error {
+	newJob := NewIssueCommentPageSyncJob
+	if t == PullRequestCommentPageSyncTask {
+		newJob = NewPullRequestCommentPageSyncJob
+	}
+
+	j, err := newJob(ctx, owner, name, page, last)
+	if err != nil {
+		return err
+	}
+
+	return s.publishJob(owner, t, j)
+}
+
+// doRepository syncs the repository record, the last step of the sync of
+// a repository.
+func (s *Syncer) doRepository(ctx context.Context, owner, name string) error {
+	if s.entities(ctx).Has(utils.RepositoryEntity) {
+		if err := s.Repository.Sync(ctx, owner, name); err != nil {
+			return err
+		}
+	}
+
+	s.stats.RepositorySynced(owner, name)
+	return nil
+}
+
+// issueComments returns the issue comments syncer, or nil if the comments
+// are not synced.
+func (s *Syncer) issueComments(ctx context.Context) *IssueCommentsSyncer {
+	if !s.entities(ctx).Has(utils.CommentEntity) {
+		return nil
+	}
+
+	return s.IssueComment
+}
+
+// pullRequestComments returns the pull request comments syncer, or nil if
+// the comments are not synced.
+func (s *Syncer) pullRequestComments(ctx context.Context) *PullRequestCommentSyncer {
+	if !s.entities(ctx).Has(utils.CommentEntity) {
+		return nil
+	}
+
+	return s.PullRequestComment
+}
+
+// pullRequestReviews returns the pull request reviews syncer, or nil if the
+// reviews are not synced.
+func (s *Syncer) pullRequestReviews(ctx context.Context) *PullRequestReviewSyncer {
+	if !s.entities(ctx).Has(utils.ReviewEntity) {
+		return nil
+	}
+
+	return s.PullRequestReview
+}
+
+// SyncRepository syncs a repository with all its issues, pull requests,
+// reviews and comments, without publishing any job to the queue.
+func (s *Syncer) SyncRepository(ctx context.Context, owner, name string) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "deep.repository", trace.WithAttributes(
+		attribute.String("ghsync.owner", owner), attribute.String("ghsync.name", name)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if err := s.syncIssues(ctx, owner, name); err != nil {
+		return err
+	}
+
+	if err := s.syncPullRequests(ctx, owner, name); err != nil {
+		return err
+	}
+
+	if err := s.doComments(ctx, owner, name); err != nil {
+		return err
+	}
+
+	return s.doRepository(ctx, owner, name)
+}
+
+func (s *Syncer) syncIssues(ctx context.Context, owner, name string) error {
+	if !s.entities(ctx).Has(utils.IssueEntity) {
+		return nil
+	}
+
+	if s.api(ctx, IssueSyncTask) == GraphQLAPI {
+		return s.Issues.SyncRepositoryGraphQL(ctx, s.issueComments(ctx), owner, name)
+	}
+
+	return s.Issues.SyncRepository(ctx, owner, name)
+}
+
+func (s *Syncer) syncPullRequests(ctx context.Context, owner, name string) error {
+	if !s.entities(ctx).Has(utils.PullRequestEntity) {
+		return nil
+	}
+
+	if s.api(ctx, PullRequestSyncTask) == GraphQLAPI {
+		return s.PullRequest.SyncRepositoryGraphQL(ctx,
+			s.pullRequestReviews(ctx), s.pullRequestComments(ctx), s.issueComments(ctx), owner, name)
+	}
+
+	return s.PullRequest.SyncRepository(ctx, s.pullRequestReviews(ctx), owner, name)
+}
+
+// SyncIssue syncs an issue and its comments.
+func (s *Syncer) SyncIssue(ctx context.Context, owner, name string, number int) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "deep.issue", trace.WithAttributes(
+		attribute.String("ghsync.owner", owner), attribute.String("ghsync.name", name),
+		attribute.Int("ghsync.number", number)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if err := s.Issues.Sync(ctx, owner, name, number); err != nil {
+		return err
+	}
+
+	if !s.entities(ctx).Has(utils.CommentEntity) {
+		return nil
+	}
+
+	return s.IssueComment.SyncIssue(ctx, owner, name, number)
+}
+
+// SyncPullRequest syncs a pull request with its reviews and comments.
+func (s *Syncer) SyncPullRequest(ctx context.Context, owner, name string, number int) (err error) {
+	ctx, span := utils.Tracer().Start(ctx, "deep.pull_request", trace.WithAttributes(
+		attribute.String("ghsync.owner", owner), attribute.String("ghsync.name", name),
+		attribute.Int("ghsync.number", number)))
+	defer func() { utils.EndSpan(span, err) }()
+
+	if s.entities(ctx).Has(utils.ReviewEntity) {
+		if err := s.PullRequestReview.SyncPullRequest(ctx, owner, name, number); err != nil {
+			return err
+		}
+	}
+
+	if err := s.PullRequest.Sync(ctx, owner, name, number); err != nil {
+		return err
+	}
+
+	if !s.entities(ctx).Has(utils.CommentEntity) {
+		return nil
+	}
+
+	if err := s.PullRequestComment.SyncPullRequest(ctx, owner, name, number); err != nil {
+		return err
+	}
+
+	return s.IssueComment.SyncIssue(ctx, owner, name, number)
 }
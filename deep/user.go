@@ -5,6 +5,7 @@ import (
 	"database/sql"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
@@ -13,18 +14,20 @@ import (
 )
 
 type UserSyncer struct {
-	s *models.UserStore
-	c *github.Client
+	s     *models.UserStore
+	c     *github.Client
+	stats *utils.Stats
 }
 
-func NewUserSyncer(db *sql.DB, c *github.Client) *UserSyncer {
+func NewUserSyncer(db *sql.DB, c *github.Client, stats *utils.Stats) *UserSyncer {
 	return &UserSyncer{
-		s: models.NewUserStore(db),
-		c: c,
+		s:     models.NewUserStore(db),
+		c:     c,
+		stats: stats,
 	}
 }
 
-func (s *UserSyncer) QueueOrganization(q queue.Queue, org string) error {
+func (s *UserSyncer) QueueOrganization(ctx context.Context, q queue.Queue, p *Progress, org string) error {
 	opts := &github.ListMembersOptions{}
 	opts.ListOptions.PerPage = listOptionsPerPage
 
@@ -32,21 +35,31 @@ func (s *UserSyncer) QueueOrganization(q queue.Queue, org string) error {
 	logger.Infof("starting to publish queue jobs")
 
 	for {
-		users, r, err := s.c.Organizations.ListMembers(context.TODO(), org, opts)
+		users, r, err := s.c.Organizations.ListMembers(ctx, org, opts)
 		if err != nil {
 			return err
 		}
 
+		var published int
 		for _, u := range users {
-			j, err := NewUserSyncJob(u.GetLogin())
+			j, err := NewUserSyncJob(ctx, org, u.GetLogin())
 			if err != nil {
 				return err
 			}
 
 			logger.With(log.Fields{"user": u.GetLogin()}).Debugf("queue request")
-			if err := q.Publish(j); err != nil {
+			ok, err := publish(q, j)
+			if err != nil {
 				return err
 			}
+
+			if ok {
+				published++
+			}
+		}
+
+		if err := p.Published(org, UserSyncTask, published); err != nil {
+			return err
 		}
 
 		if r.NextPage == 0 {
@@ -61,27 +74,36 @@ func (s *UserSyncer) QueueOrganization(q queue.Queue, org string) error {
 	return nil
 }
 
-func (s *UserSyncer) Sync(login string) error {
-	user, _, err := s.c.Users.Get(context.TODO(), login)
+func (s *UserSyncer) Sync(ctx context.Context, login string) error {
+	user, _, err := s.c.Users.Get(ctx, login)
 	if err != nil {
 		return err
 	}
 
+	end := utils.StartStoreOp(ctx, "find", utils.UserEntity)
 	record, err := s.s.FindOne(models.NewUserQuery().
 		Where(kallax.And(
 			kallax.Eq(models.Schema.User.ID, user.GetID()),
 		)),
 	)
+	end(err)
 
 	if record == nil {
 		record = models.NewUser()
 		record.User = *user
 
-		return s.s.Insert(record)
+		end := utils.StartStoreOp(ctx, "insert", utils.UserEntity)
+		err = s.s.Insert(record)
+		end(err)
+		s.stats.Record(utils.UserEntity, utils.Inserted, err)
+		return err
 	}
 
 	record.User = *user
+	end = utils.StartStoreOp(ctx, "update", utils.UserEntity)
 	_, err = s.s.Update(record)
+	end(err)
+	s.stats.Record(utils.UserEntity, utils.Updated, err)
 	return err
 
 }
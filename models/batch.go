@@ -0,0 +1,207 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/src-d/go-kallax.v1"
+)
+
+// maxBatchParams is the maximum number of parameters PostgreSQL accepts in a
+// single statement, a batch bigger than that is written in several ones.
+const maxBatchParams = 65535
+
+// Batch accumulates records of a schema, usually the ones of a listing page,
+// to write them with a single multi-row INSERT ... ON CONFLICT statement
+// instead of a FindOne followed by an Insert or an Update for each of them.
+type Batch struct {
+	schema  kallax.Schema
+	records []kallax.Record
+	index   map[interface{}]int
+}
+
+// NewBatch returns an empty batch of records of the given schema.
+func NewBatch(schema kallax.Schema) *Batch {
+	return &Batch{schema: schema, index: make(map[interface{}]int)}
+}
+
+// Add appends the record to the batch, running its BeforeSave hook as the
+// stores do on insert. A record with the same id as one already in the batch
+// replaces it, PostgreSQL refuses to upsert the same row twice in a statement.
+func (b *Batch) Add(r kallax.Record) error {
+	if err := kallax.ApplyBeforeEvents(r); err != nil {
+		return err
+	}
+
+	id := r.GetID().Raw()
+	if i, ok := b.index[id]; ok {
+		b.records[i] = r
+		return nil
+	}
+
+	b.index[id] = len(b.records)
+	b.records = append(b.records, r)
+	return nil
+}
+
+// Len returns the number of records in the batch.
+func (b *Batch) Len() int {
+	return len(b.records)
+}
+
+// Upsert writes the records of the batch, updating the ones already in the
+// table. It returns the number of records inserted and updated.
+func (b *Batch) Upsert(store *kallax.Store) (inserted, updated int, err error) {
+	cols := b.columns()
+	return b.write(store, cols, b.updateAll(cols))
+}
+
+// UpsertEach writes the records of the batch like Upsert, but with a
+// statement for each one, so a record that fails doesn't prevent the rest
+// from being written. onError is called with each record that fails.
+func (b *Batch) UpsertEach(store *kallax.Store, onError func(kallax.Record, error)) (inserted, updated int) {
+	cols := b.columns()
+	onConflict := b.updateAll(cols)
+	for _, r := range b.records {
+		i, u, err := b.writeRecords(store, []kallax.Record{r}, cols, onConflict)
+		if err != nil {
+			onError(r, err)
+			continue
+		}
+
+		inserted += i
+		updated += u
+	}
+
+	return inserted, updated
+}
+
+// InsertNew writes the records of the batch that are not in the table yet,
+// leaving the existing ones untouched. It returns the number of records
+// inserted.
+func (b *Batch) InsertNew(store *kallax.Store) (inserted int, err error) {
+	inserted, _, err = b.write(store, b.columns(), "DO NOTHING")
+	return inserted, err
+}
+
+func (b *Batch) columns() []string {
+	return kallax.ColumnNames(b.schema.Columns())
+}
+
+// updateAll returns the ON CONFLICT action updating all the columns but the
+// primary key.
+func (b *Batch) updateAll(cols []string) string {
+	set := make([]string, 0, len(cols))
+	for _, c := range cols {
+		if c == b.schema.ID().String() {
+			continue
+		}
+
+		set = append(set, fmt.Sprintf("%[1]s=EXCLUDED.%[1]s", c))
+	}
+
+	return fmt.Sprintf("DO UPDATE SET %s", strings.Join(set, ", "))
+}
+
+func (b *Batch) write(store *kallax.Store, cols []string, onConflict string) (inserted, updated int, err error) {
+	size := maxBatchParams / len(cols)
+	for start := 0; start < len(b.records); start += size {
+		end := start + size
+		if end > len(b.records) {
+			end = len(b.records)
+		}
+
+		i, u, err := b.writeRecords(store, b.records[start:end], cols, onConflict)
+		inserted += i
+		updated += u
+		if err != nil {
+			return inserted, updated, err
+		}
+	}
+
+	return inserted, updated, nil
+}
+
+// writeRecords runs a single statement. The rows it returns tell whether each
+// one was inserted or updated: xmax is zero only for the rows inserted by the
+// current transaction. With DO NOTHING only the inserted rows are returned.
+func (b *Batch) writeRecords(
+	store *kallax.Store,
+	records []kallax.Record,
+	cols []string,
+	onConflict string,
+) (inserted, updated int, err error) {
+	var values bytes.Buffer
+	params := make([]interface{}, 0, len(records)*len(cols))
+	for i, r := range records {
+		v, vcols, err := kallax.RecordValues(r, cols...)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		// the columns without value are skipped, that would misalign the
+		// values of the rows
+		if !equalColumns(vcols, cols) {
+			return 0, 0, fmt.Errorf("the values of a %s record don't match its columns: %v, expected %v",
+				b.schema.Table(), vcols, cols)
+		}
+
+		if i != 0 {
+			values.WriteRune(',')
+		}
+
+		values.WriteRune('(')
+		for j := range v {
+			if j != 0 {
+				values.WriteRune(',')
+			}
+
+			values.WriteString(fmt.Sprintf("$%d", len(params)+j+1))
+		}
+		values.WriteRune(')')
+
+		params = append(params, v...)
+	}
+
+	stm := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) %s RETURNING (xmax = 0)",
+		b.schema.Table(), strings.Join(cols, ","), values.String(),
+		b.schema.ID().String(), onConflict,
+	)
+
+	rs, err := store.RawQuery(stm, params...)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rs.Close()
+
+	for rs.Next() {
+		var isNew bool
+		if err := rs.RawScan(&isNew); err != nil {
+			return inserted, updated, err
+		}
+
+		if isNew {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+
+	return inserted, updated, nil
+}
+
+func equalColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
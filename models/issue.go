@@ -34,7 +34,7 @@ func (i *Issue) BeforeSave() error {
 	i.KallaxID = i.Issue.GetID()
 
 	var err error
-	i.RepositoryOwner, i.RepositoryName, _, err = utils.ParseIssueURL(i.GetURL())
+	i.RepositoryOwner, i.RepositoryName, _, err = utils.ParseAPIURL(i.GetURL())
 	if err != nil {
 		return err
 	}
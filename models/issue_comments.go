@@ -22,7 +22,7 @@ type IssueComment struct {
 
 func (i *IssueComment) BeforeSave() error {
 	var err error
-	i.RepositoryOwner, i.RepositoryName, i.IssueNumber, err = utils.ParseIssueURL(i.GetIssueURL())
+	i.RepositoryOwner, i.RepositoryName, i.IssueNumber, err = utils.ParseAPIURL(i.GetIssueURL())
 	if err != nil {
 		return err
 	}
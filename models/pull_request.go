@@ -49,7 +49,7 @@ func (i *PullRequest) BeforeSave() error {
 	i.KallaxID = i.PullRequest.GetID()
 
 	var err error
-	i.RepositoryOwner, i.RepositoryName, _, err = utils.ParsePullRequestURL(i.GetURL())
+	i.RepositoryOwner, i.RepositoryName, _, err = utils.ParseAPIURL(i.GetURL())
 	if err != nil {
 		return err
 	}
@@ -24,7 +24,7 @@ func (i *PullRequestComment) BeforeSave() error {
 	i.KallaxID = i.PullRequestComment.GetID()
 
 	var err error
-	i.RepositoryOwner, i.RepositoryName, i.PullRequestNumber, err = utils.ParsePullRequestURL(i.GetPullRequestURL())
+	i.RepositoryOwner, i.RepositoryName, i.PullRequestNumber, err = utils.ParseAPIURL(i.GetPullRequestURL())
 	if err != nil {
 		return err
 	}
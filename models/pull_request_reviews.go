@@ -24,7 +24,7 @@ func (i *PullRequestReview) BeforeSave() error {
 	i.KallaxID = i.PullRequestReview.GetID()
 
 	var err error
-	i.RepositoryOwner, i.RepositoryName, i.PullRequestNumber, err = utils.ParsePullRequestURL(i.GetPullRequestURL())
+	i.RepositoryOwner, i.RepositoryName, i.PullRequestNumber, err = utils.ParseAPIURL(i.GetPullRequestURL())
 	if err != nil {
 		return err
 	}
@@ -1,3 +1,9 @@
 package shallow
 
-const listOptionsPerPage = 100
+const (
+	listOptionsPerPage = 100
+
+	// userOwnerType is the type of the owners that are user accounts instead
+	// of organizations
+	userOwnerType = "User"
+)
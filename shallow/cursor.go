@@ -0,0 +1,133 @@
+package shallow
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/src-d/ghsync/utils"
+
+	"gopkg.in/src-d/go-kallax.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// Cursors keeps in a table the cursor of the entities of each repository, so
+// an interrupted sync resumes where it left off. All its methods can be
+// called on a nil Cursors, that always starts from the first page.
+type Cursors struct {
+	db        *sql.DB
+	tableName string
+}
+
+// NewCursors returns a Cursors that reads and writes the given table, as
+// created by CreateCursorTable.
+func NewCursors(db *sql.DB, tableName string) *Cursors {
+	return &Cursors{db: db, tableName: tableName}
+}
+
+// CreateCursorTable creates the cursor table if it doesn't exist.
+func CreateCursorTable(db *sql.DB, tableName string) error {
+	stm := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+    owner VARCHAR (100) NOT NULL,
+    name VARCHAR (100) NOT NULL,
+    entity VARCHAR (20) NOT NULL,
+    page INTEGER NOT NULL,
+    last_created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_number INTEGER NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (owner, name, entity)
+);`, tableName)
+	log.Debugf("running statement: %s", stm)
+	if _, err := db.Exec(stm); err != nil {
+		return fmt.Errorf("an error occured while ensuring the %s table: %v", tableName, err)
+	}
+
+	return nil
+}
+
+// Cursor is the position of an interrupted sync of the entity of a
+// repository. The listings are sorted by creation time, newest first, and
+// the page alone isn't enough to resume them: the items deleted since the
+// cursor was saved shift the rest to the previous pages, so some would be
+// skipped. The last item written is kept too, to find where to resume.
+type Cursor struct {
+	// Page is the next page to retrieve
+	Page int
+	// CreatedAt and Number identify the last item written
+	CreatedAt time.Time
+	Number    int
+}
+
+// NewCursor returns the cursor of the next page, after the item with the
+// given creation time and number. It returns nil for the last page, so the
+// cursor is cleared.
+func NewCursor(page int, createdAt time.Time, number int) *Cursor {
+	if page == 0 {
+		return nil
+	}
+
+	return &Cursor{Page: page, CreatedAt: createdAt, Number: number}
+}
+
+// Written returns true if the item with the given creation time and number
+// was written before the cursor was saved, that is, if it's not after the
+// last item written in the listing. It returns false on a nil Cursor.
+func (c *Cursor) Written(createdAt time.Time, number int) bool {
+	if c == nil {
+		return false
+	}
+
+	if createdAt.Equal(c.CreatedAt) {
+		return number >= c.Number
+	}
+
+	return createdAt.After(c.CreatedAt)
+}
+
+// Get returns the cursor of the entity of a repository, nil if its sync
+// wasn't interrupted.
+func (c *Cursors) Get(owner, name string, e utils.Entity) (*Cursor, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	stm := fmt.Sprintf(`SELECT page, last_created_at, last_number FROM %s
+WHERE owner=$1 AND name=$2 AND entity=$3`, c.tableName)
+
+	var cursor Cursor
+	err := c.db.QueryRow(stm, owner, name, string(e)).Scan(&cursor.Page, &cursor.CreatedAt, &cursor.Number)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("an error occured while reading %s table: %v", c.tableName, err)
+	}
+
+	return &cursor, nil
+}
+
+// Save records the cursor of the entity of a repository, a nil cursor clears
+// it once the last page is synced. It's written with the store of the
+// transaction of the page, so both are committed together.
+func (c *Cursors) Save(store *kallax.Store, owner, name string, e utils.Entity, cursor *Cursor) error {
+	if c == nil {
+		return nil
+	}
+
+	stm := fmt.Sprintf("DELETE FROM %s WHERE owner=$1 AND name=$2 AND entity=$3", c.tableName)
+	args := []interface{}{owner, name, string(e)}
+	if cursor != nil {
+		stm = fmt.Sprintf(`INSERT INTO %s (owner, name, entity, page, last_created_at, last_number)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (owner, name, entity) DO UPDATE SET page=EXCLUDED.page,
+last_created_at=EXCLUDED.last_created_at, last_number=EXCLUDED.last_number, updated_at=now()`, c.tableName)
+		args = append(args, cursor.Page, cursor.CreatedAt, cursor.Number)
+	}
+
+	if _, err := store.RawExec(stm, args...); err != nil {
+		return fmt.Errorf("an error occured while updating %s table: %v", c.tableName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package shallow
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/src-d/ghsync/utils"
+
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// OnError is the policy applied when an organization, repository or user of
+// a shallow sync fails.
+type OnError string
+
+const (
+	// AbortOnError stops the sync on the first failure
+	AbortOnError OnError = "abort"
+	// ContinueOnError records the failure and carries on with the rest
+	ContinueOnError OnError = "continue"
+)
+
+// ParseOnError parses an error policy, abort is returned if it's empty.
+func ParseOnError(value string) (OnError, error) {
+	switch p := OnError(value); p {
+	case "":
+		return AbortOnError, nil
+	case AbortOnError, ContinueOnError:
+		return p, nil
+	}
+
+	return "", fmt.Errorf("unknown error policy %q", value)
+}
+
+// FailedItem is an organization, repository or user that failed to sync.
+type FailedItem struct {
+	Org    string       `json:"org"`
+	Entity utils.Entity `json:"entity"`
+	Item   string       `json:"item"`
+	Err    string       `json:"error"`
+}
+
+// FailedItemsError is returned at the end of a sync that carried on after
+// some items failed.
+type FailedItemsError struct {
+	Items []FailedItem
+}
+
+func (e *FailedItemsError) Error() string {
+	items := make([]string, len(e.Items))
+	for i, item := range e.Items {
+		items[i] = fmt.Sprintf("%s %s: %s", item.Entity, item.Item, item.Err)
+	}
+
+	return fmt.Sprintf("%d items failed to sync: %s", len(e.Items), strings.Join(items, "; "))
+}
+
+// Failures records the items that failed in a table, along with the run, and
+// applies the error policy. All its methods can be called on a nil Failures,
+// that aborts on the first failure without recording it.
+type Failures struct {
+	db        *sql.DB
+	tableName string
+	runID     int64
+	policy    OnError
+
+	m     sync.Mutex
+	items []FailedItem
+}
+
+// NewFailures returns a Failures that writes into the given table, as created
+// by CreateFailureTable, the items failed in the run.
+func NewFailures(db *sql.DB, tableName string, runID int64, policy OnError) *Failures {
+	return &Failures{
+		db:        db,
+		tableName: tableName,
+		runID:     runID,
+		policy:    policy,
+	}
+}
+
+// CreateFailureTable creates the failures table if it doesn't exist.
+func CreateFailureTable(db *sql.DB, tableName string) error {
+	stm := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
+    id serial PRIMARY KEY,
+    run_id INTEGER NOT NULL,
+    org VARCHAR (50) NOT NULL,
+    entity VARCHAR (20) NOT NULL,
+    item VARCHAR (150) NOT NULL,
+    error TEXT NOT NULL,
+    failed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);`, tableName)
+	log.Debugf("running statement: %s", stm)
+	if _, err := db.Exec(stm); err != nil {
+		return fmt.Errorf("an error occured while ensuring the %s table: %v", tableName, err)
+	}
+
+	return nil
+}
+
+// Handle applies the error policy to an item that failed. It returns nil if
+// the sync must carry on, after recording the failure, or the error if it
+// must be aborted. A sync is always aborted if ctx was cancelled.
+func (f *Failures) Handle(ctx context.Context, org string, e utils.Entity, item string, err error) error {
+	if f == nil || f.policy != ContinueOnError || ctx.Err() != nil {
+		return err
+	}
+
+	failed := FailedItem{Org: org, Entity: e, Item: item, Err: err.Error()}
+
+	stm := fmt.Sprintf("INSERT INTO %s (run_id, org, entity, item, error) VALUES ($1, $2, $3, $4, $5)",
+		f.tableName)
+	if _, err := f.db.Exec(stm, f.runID, org, string(e), item, failed.Err); err != nil {
+		return fmt.Errorf("an error occured while updating %s table: %v", f.tableName, err)
+	}
+
+	log.With(log.Fields{"org": org, "entity": e, "item": item}).
+		Warningf("failed to sync, continuing with the rest: %v", err)
+
+	f.m.Lock()
+	f.items = append(f.items, failed)
+	f.m.Unlock()
+
+	return nil
+}
+
+// Err returns a *FailedItemsError with the items failed, or nil if none
+// failed.
+func (f *Failures) Err() error {
+	if f == nil {
+		return nil
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if len(f.items) == 0 {
+		return nil
+	}
+
+	return &FailedItemsError{Items: append([]FailedItem(nil), f.items...)}
+}
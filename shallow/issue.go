@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
@@ -13,83 +14,96 @@ import (
 )
 
 type IssueSyncer struct {
-	db     *sql.DB
-	client *github.Client
+	db      *sql.DB
+	client  *github.Client
+	cursors *Cursors
+	stats   *utils.Stats
 }
 
-func NewIssueSyncer(db *sql.DB, c *github.Client) *IssueSyncer {
+func NewIssueSyncer(db *sql.DB, c *github.Client, cursors *Cursors, stats *utils.Stats) *IssueSyncer {
 	return &IssueSyncer{
-		db:     db,
-		client: c,
+		db:      db,
+		client:  c,
+		cursors: cursors,
+		stats:   stats,
 	}
 }
 
-func (s *IssueSyncer) Sync(owner, repo string, logger log.Logger) error {
-	store := models.NewIssueStore(s.db)
-	return store.Transaction(func(store *models.IssueStore) error {
-		return s.doIssues(store, owner, repo, logger)
-	})
-}
-
-func (s *IssueSyncer) doIssues(store *models.IssueStore, owner, repo string, logger log.Logger) error {
+// Sync syncs the issues of a repository. Each page is written in its own
+// transaction along with the cursor of the next one, so an interrupted sync
+// resumes after the last item written.
+func (s *IssueSyncer) Sync(ctx context.Context, owner, repo string, logger log.Logger) error {
 	opts := &github.IssueListByRepoOptions{}
 	opts.ListOptions.PerPage = listOptionsPerPage
 	opts.State = "all"
+	// the cursor relies on this order
+	opts.Sort = "created"
+	opts.Direction = "desc"
+
+	list := func(page int) ([]listedItem, *github.Response, error) {
+		opts.Page = page
+		issues, r, err := s.client.Issues.ListByRepo(ctx, owner, repo, opts)
+		items := make([]listedItem, len(issues))
+		for i, issue := range issues {
+			items[i] = issue
+		}
 
-	logger.Infof("starting to retrieve issues")
+		return items, r, err
+	}
 
-	// Get the list of all issues
-	for {
-		issues, r, err := s.client.Issues.ListByRepo(context.TODO(), owner, repo, opts)
-		if err != nil {
-			return err
+	write := func(store *kallax.Store, items []listedItem) error {
+		issues := make([]*github.Issue, len(items))
+		for i, item := range items {
+			issues[i] = item.(*github.Issue)
 		}
 
-		for _, i := range issues {
-			if i.IsPullRequest() {
-				continue
-			}
-
-			logger := logger.With(log.Fields{"issue": i.GetNumber()})
-
-			_, err := store.FindOne(models.NewIssueQuery().
-				Where(kallax.And(
-					kallax.Eq(models.Schema.Issue.RepositoryOwner, owner),
-					kallax.Eq(models.Schema.Issue.RepositoryName, repo),
-					kallax.Eq(models.Schema.Issue.Number, i.GetNumber()),
-				)),
-			)
-
-			if err != nil && err != kallax.ErrNotFound {
-				logger.Errorf(err, "failed to read the resource from the DB")
-				return fmt.Errorf("failed to read the resource from the DB: %v", err)
-			}
-
-			if err == nil {
-				logger.Infof("resource already exists, skipping")
-				continue
-			}
-
-			record := models.NewIssue()
-			record.Issue = *i
-
-			err = store.Insert(record)
-			if err != nil {
-				logger.Errorf(err, "failed to write the resource into the DB")
-				return fmt.Errorf("failed to write the resource into the DB: %v", err)
-			}
-
-			logger.Debugf("resource written in the DB")
+		return s.doIssues(ctx, store, owner, repo, issues, logger)
+	}
+
+	return syncPages(s.db, s.cursors, owner, repo, utils.IssueEntity, list, write, logger)
+}
+
+func (s *IssueSyncer) doIssues(
+	ctx context.Context,
+	store *kallax.Store,
+	owner, repo string,
+	issues []*github.Issue,
+	logger log.Logger,
+) error {
+	batch := models.NewBatch(models.Schema.Issue.BaseSchema)
+	for _, i := range issues {
+		if i.IsPullRequest() {
+			continue
 		}
 
-		if r.NextPage == 0 {
-			break
+		record := models.NewIssue()
+		record.Issue = *i
+
+		if err := batch.Add(record); err != nil {
+			s.stats.Record(utils.IssueEntity, utils.Failed, err)
+			logger.With(log.Fields{"issue": i.GetNumber()}).Errorf(err, "failed to prepare the resource")
+			return fmt.Errorf("failed to prepare the resource: %v", err)
 		}
+	}
+
+	n := batch.Len()
+	if n == 0 {
+		return nil
+	}
 
-		opts.Page = r.NextPage
+	end := utils.StartStoreOp(ctx, "insert", utils.IssueEntity)
+	inserted, err := batch.InsertNew(store)
+	end(err)
+	if err != nil {
+		s.stats.RecordN(utils.IssueEntity, utils.Failed, n, err)
+		logger.Errorf(err, "failed to write the resources into the DB")
+		return fmt.Errorf("failed to write the resources into the DB: %v", err)
 	}
 
-	logger.Infof("finished to retrieve issues")
+	s.stats.RecordN(utils.IssueEntity, utils.Inserted, inserted, nil)
+	s.stats.RecordN(utils.IssueEntity, utils.Skipped, n-inserted, nil)
+	logger.With(log.Fields{"inserted": inserted, "skipped": n - inserted}).
+		Debugf("resources written in the DB, the existing ones skipped")
 
 	return nil
 }
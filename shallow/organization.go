@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
@@ -17,32 +18,67 @@ type OrganizationSyncer struct {
 	store           *models.OrganizationStore
 	client          *github.Client
 	statusTableName string
-	skipForks       bool
+	cursors         *Cursors
+	failures        *Failures
+	filter          *utils.RepositoryFilter
+	entities        utils.Entities
+	parallelism     int
+	stats           *utils.Stats
 }
 
-func NewOrganizationSyncer(db *sql.DB, c *github.Client, statusTableName string, skipForks bool) *OrganizationSyncer {
+func NewOrganizationSyncer(
+	db *sql.DB,
+	c *github.Client,
+	statusTableName string,
+	cursors *Cursors,
+	failures *Failures,
+	filter *utils.RepositoryFilter,
+	entities utils.Entities,
+	parallelism int,
+	stats *utils.Stats,
+) *OrganizationSyncer {
 	return &OrganizationSyncer{
 		db:              db,
 		store:           models.NewOrganizationStore(db),
 		client:          c,
 		statusTableName: statusTableName,
-		skipForks:       skipForks,
+		cursors:         cursors,
+		failures:        failures,
+		filter:          filter,
+		entities:        entities,
+		parallelism:     parallelism,
+		stats:           stats,
 	}
 }
 
-func (s *OrganizationSyncer) Sync(login string) error {
+// Sync syncs an organization, or the repositories of a user if the login
+// belongs to a user account.
+func (s *OrganizationSyncer) Sync(ctx context.Context, login string) error {
 	logger := log.With(log.Fields{"organization": login})
 
-	_, err := s.store.FindOne(models.NewOrganizationQuery().
+	owner, _, err := s.client.Users.Get(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	if owner.GetType() == userOwnerType {
+		return s.syncUser(ctx, owner, logger)
+	}
+
+	end := utils.StartStoreOp(ctx, "find", utils.OrganizationEntity)
+	_, err = s.store.FindOne(models.NewOrganizationQuery().
 		Where(kallax.Eq(models.Schema.Organization.Login, login)),
 	)
+	end(err)
 
 	if err != nil && err != kallax.ErrNotFound {
+		s.stats.Record(utils.OrganizationEntity, utils.Failed, err)
 		logger.Errorf(err, "failed to read the resource from the DB")
 		return fmt.Errorf("failed to read the resource from the DB: %v", err)
 	}
 
 	if err == nil {
+		s.stats.Record(utils.OrganizationEntity, utils.Skipped, nil)
 		logger.Infof("resource already exists, skipping")
 		stm := fmt.Sprintf("UPDATE %s SET total=0 WHERE org='%s'", s.statusTableName, login)
 		_, err = s.db.Exec(stm)
@@ -53,29 +89,42 @@ func (s *OrganizationSyncer) Sync(login string) error {
 		return nil
 	}
 
-	org, _, err := s.client.Organizations.Get(context.TODO(), login)
+	org, _, err := s.client.Organizations.Get(ctx, login)
 	if err != nil {
 		return err
 	}
 
-	repoSyncer := NewRepositorySyncer(s.db, s.client, s.statusTableName, s.skipForks)
-	err = repoSyncer.Sync(login, logger)
+	repoSyncer := NewRepositorySyncer(s.db, s.client, s.statusTableName, s.cursors, s.failures, s.filter, s.entities, s.parallelism, s.stats)
+	err = repoSyncer.Sync(ctx, login, logger)
 	if err != nil {
 		return err
 	}
 
-	userSyncer := NewUserSyncer(s.db, s.client, s.statusTableName)
-	err = userSyncer.Sync(login, logger)
-	if err != nil {
+	if s.entities.Has(utils.UserEntity) {
+		userSyncer := NewUserSyncer(s.db, s.client, s.statusTableName, s.failures, s.stats)
+		err = userSyncer.Sync(ctx, login, logger)
+		if err != nil {
+			return err
+		}
+	} else if err := s.skipStatus(login, "user"); err != nil {
 		return err
 	}
 
+	// the organization record marks it as done, so it's only written when
+	// all the entities were synced
+	if !s.entities.All() {
+		return nil
+	}
+
 	record := models.NewOrganization()
 	record.Organization = *org
 
 	logger.Debugf("inserting resource")
 
+	end = utils.StartStoreOp(ctx, "insert", utils.OrganizationEntity)
 	err = s.store.Insert(record)
+	end(err)
+	s.stats.Record(utils.OrganizationEntity, utils.Inserted, err)
 	if err != nil {
 		logger.Errorf(err, "failed to write the resource into the DB")
 		return fmt.Errorf("failed to write the resource into the DB: %v", err)
@@ -85,3 +134,40 @@ func (s *OrganizationSyncer) Sync(login string) error {
 
 	return nil
 }
+
+// syncUser syncs the repositories of a user account. Users don't have a
+// record to mark them as done like the organizations do, so the existing
+// repositories are skipped one by one. Org-only entities, like the members,
+// don't apply to them.
+func (s *OrganizationSyncer) syncUser(ctx context.Context, user *github.User, parentLogger log.Logger) error {
+	logger := parentLogger.With(log.Fields{"owner-type": userOwnerType})
+
+	if err := s.skipStatus(user.GetLogin(), "user"); err != nil {
+		return err
+	}
+
+	repoSyncer := NewRepositorySyncer(s.db, s.client, s.statusTableName, s.cursors, s.failures, s.filter, s.entities, s.parallelism, s.stats)
+	if err := repoSyncer.SyncUser(ctx, user.GetLogin(), logger); err != nil {
+		return err
+	}
+
+	if !s.entities.Has(utils.UserEntity) {
+		return nil
+	}
+
+	userSyncer := NewUserSyncer(s.db, s.client, s.statusTableName, s.failures, s.stats)
+	return userSyncer.doUser(ctx, user, logger)
+}
+
+// skipStatus marks an entity of the organization as having nothing to sync
+// in the status table.
+func (s *OrganizationSyncer) skipStatus(login, entity string) error {
+	stm := fmt.Sprintf("UPDATE %s SET total=0 WHERE org='%s' AND entity='%s'",
+		s.statusTableName, login, entity)
+	log.Debugf("running statement: %s", stm)
+	if _, err := s.db.Exec(stm); err != nil {
+		return fmt.Errorf("unable to update status for org %s: %v", login, err)
+	}
+
+	return nil
+}
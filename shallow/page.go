@@ -0,0 +1,103 @@
+package shallow
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/src-d/ghsync/utils"
+
+	"github.com/google/go-github/github"
+	"gopkg.in/src-d/go-kallax.v1"
+	"gopkg.in/src-d/go-log.v1"
+)
+
+// listedItem is an item of a listing sorted by creation time, newest first,
+// as the cursors require.
+type listedItem interface {
+	GetCreatedAt() time.Time
+	GetNumber() int
+}
+
+// listPageFunc retrieves a page of a listing.
+type listPageFunc func(page int) ([]listedItem, *github.Response, error)
+
+// writePageFunc writes the items of a page with the store of its
+// transaction.
+type writePageFunc func(store *kallax.Store, items []listedItem) error
+
+// syncPages retrieves all the pages of the listing of the entity of a
+// repository. Each page is written in its own transaction along with the
+// cursor of the next one, so an interrupted sync resumes after the last item
+// written.
+func syncPages(
+	db *sql.DB,
+	cursors *Cursors,
+	owner, repo string,
+	e utils.Entity,
+	list listPageFunc,
+	write writePageFunc,
+	logger log.Logger,
+) error {
+	cursor, err := cursors.Get(owner, repo, e)
+	if err != nil {
+		return err
+	}
+
+	page := 0
+	if cursor != nil {
+		page = cursor.Page
+		logger.With(log.Fields{"page": cursor.Page}).Infof("resuming the interrupted sync of %s", e)
+	} else {
+		logger.Infof("starting to retrieve %s", e)
+	}
+
+	store := kallax.NewStore(db)
+
+	for {
+		items, r, err := list(page)
+		if err != nil {
+			return err
+		}
+
+		next := NewCursor(r.NextPage, time.Time{}, 0)
+		if n := len(items); n != 0 {
+			next = NewCursor(r.NextPage, items[n-1].GetCreatedAt(), items[n-1].GetNumber())
+		}
+
+		if cursor != nil {
+			// the deleted items shift the rest to the previous pages, so the
+			// last item written could be in one of them
+			if page > 1 && (len(items) == 0 || !cursor.Written(items[0].GetCreatedAt(), items[0].GetNumber())) {
+				page--
+				continue
+			}
+
+			for len(items) != 0 && cursor.Written(items[0].GetCreatedAt(), items[0].GetNumber()) {
+				items = items[1:]
+			}
+
+			cursor = nil
+		}
+
+		err = store.Transaction(func(store *kallax.Store) error {
+			if err := write(store, items); err != nil {
+				return err
+			}
+
+			return cursors.Save(store, owner, repo, e, next)
+		})
+		if err != nil {
+			return err
+		}
+
+		if r.NextPage == 0 {
+			break
+		}
+
+		page = r.NextPage
+	}
+
+	logger.Infof("finished to retrieve %s", e)
+
+	return nil
+}
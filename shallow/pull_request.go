@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
@@ -13,79 +14,92 @@ import (
 )
 
 type PullRequestSyncer struct {
-	db     *sql.DB
-	client *github.Client
+	db      *sql.DB
+	client  *github.Client
+	cursors *Cursors
+	stats   *utils.Stats
 }
 
-func NewPullRequestSyncer(db *sql.DB, c *github.Client) *PullRequestSyncer {
+func NewPullRequestSyncer(db *sql.DB, c *github.Client, cursors *Cursors, stats *utils.Stats) *PullRequestSyncer {
 	return &PullRequestSyncer{
-		db:     db,
-		client: c,
+		db:      db,
+		client:  c,
+		cursors: cursors,
+		stats:   stats,
 	}
 }
 
-func (s *PullRequestSyncer) Sync(owner, repo string, logger log.Logger) error {
-	store := models.NewPullRequestStore(s.db)
-	return store.Transaction(func(store *models.PullRequestStore) error {
-		return s.doPRs(store, owner, repo, logger)
-	})
-}
-
-func (s *PullRequestSyncer) doPRs(store *models.PullRequestStore, owner, repo string, logger log.Logger) error {
+// Sync syncs the pull requests of a repository. Each page is written in its
+// own transaction along with the cursor of the next one, so an interrupted
+// sync resumes after the last item written.
+func (s *PullRequestSyncer) Sync(ctx context.Context, owner, repo string, logger log.Logger) error {
 	opts := &github.PullRequestListOptions{}
 	opts.ListOptions.PerPage = listOptionsPerPage
 	opts.State = "all"
+	// the cursor relies on this order
+	opts.Sort = "created"
+	opts.Direction = "desc"
+
+	list := func(page int) ([]listedItem, *github.Response, error) {
+		opts.Page = page
+		prs, r, err := s.client.PullRequests.List(ctx, owner, repo, opts)
+		items := make([]listedItem, len(prs))
+		for i, pr := range prs {
+			items[i] = pr
+		}
 
-	logger.Infof("starting to retrieve PRs")
+		return items, r, err
+	}
 
-	// Get the list of all PRs
-	for {
-		prs, r, err := s.client.PullRequests.List(context.TODO(), owner, repo, opts)
-		if err != nil {
-			return err
+	write := func(store *kallax.Store, items []listedItem) error {
+		prs := make([]*github.PullRequest, len(items))
+		for i, item := range items {
+			prs[i] = item.(*github.PullRequest)
 		}
 
-		for _, pr := range prs {
-			logger := logger.With(log.Fields{"pr": pr.GetNumber()})
-
-			_, err := store.FindOne(models.NewPullRequestQuery().
-				Where(kallax.And(
-					kallax.Eq(models.Schema.Issue.RepositoryOwner, owner),
-					kallax.Eq(models.Schema.Issue.RepositoryName, repo),
-					kallax.Eq(models.Schema.Issue.Number, pr.GetNumber()),
-				)),
-			)
-
-			if err != nil && err != kallax.ErrNotFound {
-				logger.Errorf(err, "failed to read the resource from the DB")
-				return fmt.Errorf("failed to read the resource from the DB: %v", err)
-			}
-
-			if err == nil {
-				logger.Infof("resource already exists, skipping")
-				continue
-			}
-
-			record := models.NewPullRequest()
-			record.PullRequest = *pr
-
-			err = store.Insert(record)
-			if err != nil {
-				logger.Errorf(err, "failed to write the resource into the DB")
-				return fmt.Errorf("failed to write the resource into the DB: %v", err)
-			}
-
-			logger.Debugf("resource written in the DB")
-		}
+		return s.doPRs(ctx, store, owner, repo, prs, logger)
+	}
 
-		if r.NextPage == 0 {
-			break
+	return syncPages(s.db, s.cursors, owner, repo, utils.PullRequestEntity, list, write, logger)
+}
+
+func (s *PullRequestSyncer) doPRs(
+	ctx context.Context,
+	store *kallax.Store,
+	owner, repo string,
+	prs []*github.PullRequest,
+	logger log.Logger,
+) error {
+	batch := models.NewBatch(models.Schema.PullRequest.BaseSchema)
+	for _, pr := range prs {
+		record := models.NewPullRequest()
+		record.PullRequest = *pr
+
+		if err := batch.Add(record); err != nil {
+			s.stats.Record(utils.PullRequestEntity, utils.Failed, err)
+			logger.With(log.Fields{"pr": pr.GetNumber()}).Errorf(err, "failed to prepare the resource")
+			return fmt.Errorf("failed to prepare the resource: %v", err)
 		}
+	}
+
+	n := batch.Len()
+	if n == 0 {
+		return nil
+	}
 
-		opts.Page = r.NextPage
+	end := utils.StartStoreOp(ctx, "insert", utils.PullRequestEntity)
+	inserted, err := batch.InsertNew(store)
+	end(err)
+	if err != nil {
+		s.stats.RecordN(utils.PullRequestEntity, utils.Failed, n, err)
+		logger.Errorf(err, "failed to write the resources into the DB")
+		return fmt.Errorf("failed to write the resources into the DB: %v", err)
 	}
 
-	logger.Infof("finished to retrieve PRs")
+	s.stats.RecordN(utils.PullRequestEntity, utils.Inserted, inserted, nil)
+	s.stats.RecordN(utils.PullRequestEntity, utils.Skipped, n-inserted, nil)
+	logger.With(log.Fields{"inserted": inserted, "skipped": n - inserted}).
+		Debugf("resources written in the DB, the existing ones skipped")
 
 	return nil
 }
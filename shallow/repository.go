@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
@@ -17,22 +18,75 @@ type RepositorySyncer struct {
 	store           *models.RepositoryStore
 	client          *github.Client
 	statusTableName string
-	skipForks       bool
+	cursors         *Cursors
+	failures        *Failures
+	filter          *utils.RepositoryFilter
+	entities        utils.Entities
+	parallelism     int
+	stats           *utils.Stats
 }
 
-func NewRepositorySyncer(db *sql.DB, c *github.Client, statusTableName string, skipForks bool) *RepositorySyncer {
+func NewRepositorySyncer(
+	db *sql.DB,
+	c *github.Client,
+	statusTableName string,
+	cursors *Cursors,
+	failures *Failures,
+	filter *utils.RepositoryFilter,
+	entities utils.Entities,
+	parallelism int,
+	stats *utils.Stats,
+) *RepositorySyncer {
 	return &RepositorySyncer{
 		db:              db,
 		store:           models.NewRepositoryStore(db),
 		client:          c,
 		statusTableName: statusTableName,
-		skipForks:       skipForks,
+		cursors:         cursors,
+		failures:        failures,
+		filter:          filter,
+		entities:        entities,
+		parallelism:     parallelism,
+		stats:           stats,
 	}
 }
 
-func (s *RepositorySyncer) Sync(owner string, logger log.Logger) error {
-	opts := &github.RepositoryListByOrgOptions{}
-	opts.ListOptions.PerPage = listOptionsPerPage
+type listRepositoriesFunc func(ctx context.Context, owner string, opts github.ListOptions) ([]*github.Repository, *github.Response, error)
+
+// Sync syncs the repositories of an organization.
+func (s *RepositorySyncer) Sync(ctx context.Context, owner string, logger log.Logger) error {
+	return s.doSync(ctx, owner, s.listByOrg, logger)
+}
+
+// SyncUser syncs the repositories owned by a user account.
+func (s *RepositorySyncer) SyncUser(ctx context.Context, login string, logger log.Logger) error {
+	return s.doSync(ctx, login, s.listByUser, logger)
+}
+
+// SyncRepository syncs a single repository, without updating the status
+// table.
+func (s *RepositorySyncer) SyncRepository(ctx context.Context, owner, name string, logger log.Logger) error {
+	repository, _, err := s.client.Repositories.Get(ctx, owner, name)
+	if err != nil {
+		return err
+	}
+
+	return s.doRepo(ctx, repository, logger)
+}
+
+func (s *RepositorySyncer) listByOrg(ctx context.Context, owner string, opts github.ListOptions) ([]*github.Repository, *github.Response, error) {
+	return s.client.Repositories.ListByOrg(ctx, owner,
+		&github.RepositoryListByOrgOptions{ListOptions: opts})
+}
+
+func (s *RepositorySyncer) listByUser(ctx context.Context, owner string, opts github.ListOptions) ([]*github.Repository, *github.Response, error) {
+	return s.client.Repositories.List(ctx, owner,
+		&github.RepositoryListOptions{Type: "owner", ListOptions: opts})
+}
+
+func (s *RepositorySyncer) doSync(ctx context.Context, owner string, list listRepositoriesFunc, logger log.Logger) error {
+	opts := github.ListOptions{}
+	opts.PerPage = listOptionsPerPage
 
 	logger.Infof("starting to retrieve repositories")
 
@@ -40,13 +94,14 @@ func (s *RepositorySyncer) Sync(owner string, logger log.Logger) error {
 
 	// Get the list of all repositories
 	for {
-		repositories, r, err := s.client.Repositories.ListByOrg(context.TODO(), owner, opts)
+		repositories, r, err := list(ctx, owner, opts)
 		if err != nil {
 			return err
 		}
 
 		for _, r := range repositories {
-			if s.skipForks && r.GetFork() {
+			if !s.filter.Match(r) {
+				logger.With(log.Fields{"repository": r.GetName()}).Debugf("repository filtered out, skipping")
 				continue
 			}
 			repos = append(repos, r)
@@ -67,24 +122,31 @@ func (s *RepositorySyncer) Sync(owner string, logger log.Logger) error {
 			s.statusTableName, err)
 	}
 
-	// Process each one of them
-	for _, repository := range repos {
-		err := s.doRepo(repository, logger)
+	// Process each one of them, the status is updated with increments so
+	// the repositories synced in parallel don't overwrite each other
+	err := utils.RunParallel(ctx, s.parallelism, len(repos), func(ctx context.Context, i int) error {
+		repository := repos[i]
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := s.doRepo(ctx, repository, logger)
 		if err != nil {
 			stm := fmt.Sprintf("UPDATE %s SET failed=failed + 1 WHERE org='%s' AND entity='repository'",
 				s.statusTableName, owner)
-			if err = s.updateStatus(stm); err != nil {
+			if err := s.updateStatus(stm); err != nil {
 				return err
 			}
 
-			return err
+			return s.failures.Handle(ctx, owner, utils.RepositoryEntity, repository.GetFullName(), err)
 		}
 
 		stm := fmt.Sprintf("UPDATE %s SET done=done + 1 WHERE org='%s' AND entity='repository'",
 			s.statusTableName, owner)
-		if err = s.updateStatus(stm); err != nil {
-			return err
-		}
+		return s.updateStatus(stm)
+	})
+	if err != nil {
+		return err
 	}
 
 	logger.Infof("finished to retrieve repositories")
@@ -102,45 +164,60 @@ func (s *RepositorySyncer) updateStatus(stm string) error {
 	return nil
 }
 
-func (s *RepositorySyncer) doRepo(repository *github.Repository, parentLogger log.Logger) error {
+func (s *RepositorySyncer) doRepo(ctx context.Context, repository *github.Repository, parentLogger log.Logger) error {
 	logger := parentLogger.With(log.Fields{"repository": repository.GetName()})
 
+	end := utils.StartStoreOp(ctx, "find", utils.RepositoryEntity)
 	_, err := s.store.FindOne(models.NewRepositoryQuery().
 		Where(kallax.Eq(models.Schema.Repository.ID, repository.GetID())),
 	)
+	end(err)
 
 	if err != nil && err != kallax.ErrNotFound {
+		s.stats.Record(utils.RepositoryEntity, utils.Failed, err)
 		logger.Errorf(err, "failed to read the resource from the DB")
 		return fmt.Errorf("failed to read the resource from the DB: %v", err)
 	}
 
 	if err == nil {
+		s.stats.Record(utils.RepositoryEntity, utils.Skipped, nil)
 		logger.Infof("resource already exists, skipping")
 		return nil
 	}
 
-	prSyncer := NewPullRequestSyncer(s.db, s.client)
-	err = prSyncer.Sync(repository.GetOwner().GetLogin(), repository.GetName(), logger)
-	if err != nil {
-		return err
+	if s.entities.Has(utils.PullRequestEntity) {
+		prSyncer := NewPullRequestSyncer(s.db, s.client, s.cursors, s.stats)
+		err = prSyncer.Sync(ctx, repository.GetOwner().GetLogin(), repository.GetName(), logger)
+		if err != nil {
+			return err
+		}
 	}
 
-	issueSyncer := NewIssueSyncer(s.db, s.client)
-	err = issueSyncer.Sync(repository.GetOwner().GetLogin(), repository.GetName(), logger)
-	if err != nil {
-		return err
+	if s.entities.Has(utils.IssueEntity) {
+		issueSyncer := NewIssueSyncer(s.db, s.client, s.cursors, s.stats)
+		err = issueSyncer.Sync(ctx, repository.GetOwner().GetLogin(), repository.GetName(), logger)
+		if err != nil {
+			return err
+		}
 	}
 
-	record := models.NewRepository()
-	record.Repository = *repository
+	// the repository record marks it as done, so later runs skip it
+	if s.entities.Has(utils.RepositoryEntity) {
+		record := models.NewRepository()
+		record.Repository = *repository
 
-	err = s.store.Insert(record)
-	if err != nil {
-		logger.Errorf(err, "failed to write the resource into the DB")
-		return fmt.Errorf("failed to write the resource into the DB: %v", err)
-	}
+		end = utils.StartStoreOp(ctx, "insert", utils.RepositoryEntity)
+		err = s.store.Insert(record)
+		end(err)
+		s.stats.Record(utils.RepositoryEntity, utils.Inserted, err)
+		if err != nil {
+			logger.Errorf(err, "failed to write the resource into the DB")
+			return fmt.Errorf("failed to write the resource into the DB: %v", err)
+		}
 
-	logger.Debugf("resource written in the DB")
+		logger.Debugf("resource written in the DB")
+	}
 
+	s.stats.RepositorySynced(repository.GetOwner().GetLogin(), repository.GetName())
 	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/src-d/ghsync/models"
+	"github.com/src-d/ghsync/utils"
 
 	"github.com/google/go-github/github"
 	"gopkg.in/src-d/go-kallax.v1"
@@ -17,24 +18,28 @@ type UserSyncer struct {
 	store           *models.UserStore
 	client          *github.Client
 	statusTableName string
+	failures        *Failures
+	stats           *utils.Stats
 }
 
-func NewUserSyncer(db *sql.DB, c *github.Client, statusTableName string) *UserSyncer {
+func NewUserSyncer(db *sql.DB, c *github.Client, statusTableName string, failures *Failures, stats *utils.Stats) *UserSyncer {
 	return &UserSyncer{
 		db:              db,
 		store:           models.NewUserStore(db),
 		client:          c,
 		statusTableName: statusTableName,
+		failures:        failures,
+		stats:           stats,
 	}
 }
 
-func (s *UserSyncer) Sync(org string, logger log.Logger) error {
+func (s *UserSyncer) Sync(ctx context.Context, org string, logger log.Logger) error {
 	return s.store.Transaction(func(store *models.UserStore) error {
-		return s.doUsers(store, org, logger)
+		return s.doUsers(ctx, store, org, logger)
 	})
 }
 
-func (s *UserSyncer) doUsers(store *models.UserStore, org string, logger log.Logger) error {
+func (s *UserSyncer) doUsers(ctx context.Context, store *models.UserStore, org string, logger log.Logger) error {
 	opts := &github.ListMembersOptions{}
 	opts.ListOptions.PerPage = listOptionsPerPage
 
@@ -44,7 +49,7 @@ func (s *UserSyncer) doUsers(store *models.UserStore, org string, logger log.Log
 
 	// Get the list of all users
 	for {
-		users, r, err := s.client.Organizations.ListMembers(context.TODO(), org, opts)
+		users, r, err := s.client.Organizations.ListMembers(ctx, org, opts)
 		if err != nil {
 			return err
 		}
@@ -69,15 +74,23 @@ func (s *UserSyncer) doUsers(store *models.UserStore, org string, logger log.Log
 	}
 
 	for _, user := range allUsers {
-		err := s.doUser(user, logger)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := s.doUser(ctx, user, logger)
 		if err != nil {
 			stm := fmt.Sprintf("UPDATE %s SET failed=failed + 1 WHERE org='%s' AND entity='user'",
 				s.statusTableName, org)
-			if err = s.updateStatus(stm); err != nil {
+			if err := s.updateStatus(stm); err != nil {
 				return err
 			}
 
-			return err
+			if err := s.failures.Handle(ctx, org, utils.UserEntity, user.GetLogin(), err); err != nil {
+				return err
+			}
+
+			continue
 		}
 
 		stm := fmt.Sprintf("UPDATE %s SET done=done + 1 WHERE org='%s' AND entity='user'",
@@ -102,20 +115,24 @@ func (s *UserSyncer) updateStatus(stm string) error {
 	return nil
 }
 
-func (s *UserSyncer) doUser(user *github.User, parentLogger log.Logger) error {
+func (s *UserSyncer) doUser(ctx context.Context, user *github.User, parentLogger log.Logger) error {
 	logger := parentLogger.With(log.Fields{"user": user.GetLogin()})
 
+	end := utils.StartStoreOp(ctx, "find", utils.UserEntity)
 	_, err := s.store.FindOne(models.NewUserQuery().
 		Where(kallax.And(
 			kallax.Eq(models.Schema.User.ID, user.GetID()),
 		)),
 	)
+	end(err)
 	if err != nil && err != kallax.ErrNotFound {
+		s.stats.Record(utils.UserEntity, utils.Failed, err)
 		logger.With(log.Fields{"user": user.GetLogin()}).Errorf(err, "failed to read the resource from the DB")
 		return fmt.Errorf("failed to read the resource from the DB: %v", err)
 	}
 
 	if err == nil {
+		s.stats.Record(utils.UserEntity, utils.Skipped, nil)
 		logger.With(log.Fields{"user": user.GetLogin()}).Infof("resource already exists, skipping")
 		return nil
 	}
@@ -123,7 +140,10 @@ func (s *UserSyncer) doUser(user *github.User, parentLogger log.Logger) error {
 	record := models.NewUser()
 	record.User = *user
 
+	end = utils.StartStoreOp(ctx, "insert", utils.UserEntity)
 	err = s.store.Insert(record)
+	end(err)
+	s.stats.Record(utils.UserEntity, utils.Inserted, err)
 	if err != nil {
 		logger.Errorf(err, "failed to write the resource into the DB")
 		return fmt.Errorf("failed to write the resource into the DB: %v", err)
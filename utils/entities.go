@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Entity is a kind of GitHub resource that can be synced.
+type Entity string
+
+const (
+	OrganizationEntity Entity = "organizations"
+	RepositoryEntity   Entity = "repositories"
+	IssueEntity        Entity = "issues"
+	PullRequestEntity  Entity = "pull_requests"
+	ReviewEntity       Entity = "reviews"
+	CommentEntity      Entity = "comments"
+	UserEntity         Entity = "users"
+)
+
+var allEntities = []Entity{
+	OrganizationEntity,
+	RepositoryEntity,
+	IssueEntity,
+	PullRequestEntity,
+	ReviewEntity,
+	CommentEntity,
+	UserEntity,
+}
+
+// Entities is a set of entities to be synced. A nil set contains all of
+// them.
+type Entities map[Entity]bool
+
+// ParseEntities parses a list of entity names. An empty list selects all
+// the entities.
+func ParseEntities(names []string) (Entities, error) {
+	var entities Entities
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n == "" {
+			continue
+		}
+
+		e := Entity(n)
+		if !isKnownEntity(e) {
+			return nil, fmt.Errorf("unknown entity %q, valid ones are: %s", n, entityNames())
+		}
+
+		if entities == nil {
+			entities = make(Entities)
+		}
+
+		entities[e] = true
+	}
+
+	return entities, nil
+}
+
+// Has returns true if the entity must be synced.
+func (e Entities) Has(entity Entity) bool {
+	if e == nil {
+		return true
+	}
+
+	return e[entity]
+}
+
+// All returns true if the set contains all the entities.
+func (e Entities) All() bool {
+	if e == nil {
+		return true
+	}
+
+	for _, entity := range allEntities {
+		if !e[entity] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isKnownEntity(e Entity) bool {
+	for _, known := range allEntities {
+		if e == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+func entityNames() string {
+	names := make([]string, len(allEntities))
+	for i, e := range allEntities {
+		names[i] = string(e)
+	}
+
+	return strings.Join(names, ", ")
+}
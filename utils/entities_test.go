@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEntities(t *testing.T) {
+	assert := assert.New(t)
+
+	all, err := ParseEntities(nil)
+	assert.NoError(err)
+	assert.True(all.Has(IssueEntity))
+	assert.True(all.All())
+
+	entities, err := ParseEntities([]string{"issues", " pull_requests", ""})
+	assert.NoError(err)
+	assert.True(entities.Has(IssueEntity))
+	assert.True(entities.Has(PullRequestEntity))
+	assert.False(entities.Has(CommentEntity))
+	assert.False(entities.Has(OrganizationEntity))
+	assert.False(entities.All())
+
+	entities, err = ParseEntities([]string{"organizations"})
+	assert.NoError(err)
+	assert.True(entities.Has(OrganizationEntity))
+
+	_, err = ParseEntities([]string{"issue"})
+	assert.Error(err)
+}
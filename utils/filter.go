@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// NamePattern matches repository names. Patterns between slashes, like
+// /^go-.*$/, are regular expressions, any other pattern is a glob, like
+// go-*. Patterns containing a slash are matched against the full name of
+// the repository, e.g. src-d/go-*.
+type NamePattern struct {
+	glob   string
+	regexp *regexp.Regexp
+}
+
+// NewNamePattern parses a glob or regular expression pattern.
+func NewNamePattern(pattern string) (*NamePattern, error) {
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", pattern, err)
+		}
+
+		return &NamePattern{regexp: re}, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %q: %v", pattern, err)
+	}
+
+	return &NamePattern{glob: pattern}, nil
+}
+
+// NewNamePatterns parses a list of patterns.
+func NewNamePatterns(patterns []string) ([]*NamePattern, error) {
+	var result []*NamePattern
+	for _, p := range patterns {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+
+		np, err := NewNamePattern(p)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, np)
+	}
+
+	return result, nil
+}
+
+// Match returns true if the repository name matches the pattern.
+func (p *NamePattern) Match(r *github.Repository) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(r.GetName())
+	}
+
+	name := r.GetName()
+	if strings.Contains(p.glob, "/") {
+		name = r.GetFullName()
+	}
+
+	ok, _ := path.Match(p.glob, name)
+	return ok
+}
+
+// RepositoryFilter selects the repositories to be synced. A nil filter
+// selects all of them.
+type RepositoryFilter struct {
+	// Include, if not empty, selects only the repositories matching any of
+	// the patterns
+	Include []*NamePattern
+	// Exclude skips the repositories matching any of the patterns
+	Exclude []*NamePattern
+
+	SkipArchived bool
+	SkipForks    bool
+	// Visibility can be "public" or "private", any other value selects both
+	Visibility string
+	// Topics, if not empty, selects only the repositories with any of them
+	Topics []string
+	// Languages, if not empty, selects only the repositories with any of them
+	// as main language
+	Languages []string
+	// PushedWithin, if not zero, skips the repositories without pushes in
+	// that period of time
+	PushedWithin time.Duration
+}
+
+// Match returns true if the repository must be synced.
+func (f *RepositoryFilter) Match(r *github.Repository) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Include) != 0 && !matchAny(f.Include, r) {
+		return false
+	}
+
+	if matchAny(f.Exclude, r) {
+		return false
+	}
+
+	if f.SkipArchived && r.GetArchived() {
+		return false
+	}
+
+	if f.SkipForks && r.GetFork() {
+		return false
+	}
+
+	switch f.Visibility {
+	case "public":
+		if r.GetPrivate() {
+			return false
+		}
+	case "private":
+		if !r.GetPrivate() {
+			return false
+		}
+	}
+
+	if len(f.Topics) != 0 && !containsAny(f.Topics, r.Topics) {
+		return false
+	}
+
+	if len(f.Languages) != 0 && !containsAny(f.Languages, []string{r.GetLanguage()}) {
+		return false
+	}
+
+	if f.PushedWithin != 0 && time.Since(r.GetPushedAt().Time) > f.PushedWithin {
+		return false
+	}
+
+	return true
+}
+
+func matchAny(patterns []*NamePattern, r *github.Repository) bool {
+	for _, p := range patterns {
+		if p.Match(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsAny returns true if any of the values is in the list, ignoring
+// the case.
+func containsAny(values, list []string) bool {
+	for _, v := range values {
+		for _, l := range list {
+			if strings.EqualFold(v, l) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositoryFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	include, err := NewNamePatterns([]string{"go-*", "/^ghsync$/"})
+	assert.NoError(err)
+	exclude, err := NewNamePatterns([]string{"src-d/go-git"})
+	assert.NoError(err)
+
+	f := &RepositoryFilter{
+		Include:      include,
+		Exclude:      exclude,
+		SkipArchived: true,
+		SkipForks:    true,
+		Visibility:   "public",
+		Topics:       []string{"git"},
+		Languages:    []string{"go"},
+		PushedWithin: 24 * time.Hour,
+	}
+
+	repo := func(name string, mod func(r *github.Repository)) *github.Repository {
+		r := &github.Repository{
+			Name:     github.String(name),
+			FullName: github.String("src-d/" + name),
+			Topics:   []string{"git", "sync"},
+			Language: github.String("Go"),
+			PushedAt: &github.Timestamp{Time: time.Now()},
+		}
+
+		if mod != nil {
+			mod(r)
+		}
+
+		return r
+	}
+
+	assert.True(f.Match(repo("go-kallax", nil)))
+	assert.True(f.Match(repo("ghsync", nil)))
+	assert.False(f.Match(repo("gitbase", nil)))
+	assert.False(f.Match(repo("go-git", nil)))
+	assert.False(f.Match(repo("go-kallax", func(r *github.Repository) { r.Archived = github.Bool(true) })))
+	assert.False(f.Match(repo("go-kallax", func(r *github.Repository) { r.Fork = github.Bool(true) })))
+	assert.False(f.Match(repo("go-kallax", func(r *github.Repository) { r.Private = github.Bool(true) })))
+	assert.False(f.Match(repo("go-kallax", func(r *github.Repository) { r.Topics = nil })))
+	assert.False(f.Match(repo("go-kallax", func(r *github.Repository) { r.Language = github.String("Python") })))
+	assert.False(f.Match(repo("go-kallax", func(r *github.Repository) {
+		r.PushedAt = &github.Timestamp{Time: time.Now().Add(-48 * time.Hour)}
+	})))
+
+	var all *RepositoryFilter
+	assert.True(all.Match(repo("gitbase", nil)))
+}
+
+func TestNamePatternInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewNamePattern("/[/")
+	assert.Error(err)
+
+	_, err = NewNamePattern("[")
+	assert.Error(err)
+}
@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+	pathpkg "path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "ghsync"
+
+var (
+	githubRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "github",
+		Name:      "requests_total",
+		Help:      "GitHub API requests by endpoint and status code.",
+	}, []string{"endpoint", "code"})
+
+	githubRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "github",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of the GitHub API requests by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "github",
+		Name:      "cache_requests_total",
+		Help:      "GitHub API requests answered by the HTTP cache (hit) or sent to GitHub (miss).",
+	}, []string{"result"})
+
+	rateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "github",
+		Name:      "rate_limit_remaining",
+		Help:      "Remaining GitHub API rate limit by token.",
+	}, []string{"token"})
+
+	rateLimitReset = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "github",
+		Name:      "rate_limit_reset_timestamp_seconds",
+		Help:      "Time when the GitHub API rate limit of the token is reset, in seconds since the epoch.",
+	}, []string{"token"})
+
+	limitSleeps = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "github",
+		Name:      "limit_sleeps_total",
+		Help:      "Sleeps waiting for the GitHub rate limit or abuse detection mechanism by reason.",
+	}, []string{"reason"})
+
+	limitSleepSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "github",
+		Name:      "limit_sleep_seconds_total",
+		Help:      "Time spent sleeping for the GitHub rate limit or abuse detection mechanism by reason.",
+	}, []string{"reason"})
+
+	dbWriteDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "db",
+		Name:      "write_duration_seconds",
+		Help:      "Duration of the writes of resources into the DB by entity.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"entity"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		githubRequests,
+		githubRequestDuration,
+		cacheRequests,
+		rateLimitRemaining,
+		rateLimitReset,
+		limitSleeps,
+		limitSleepSeconds,
+		dbWriteDuration,
+	)
+}
+
+const (
+	rateLimitSleep  = "rate_limit"
+	abuseLimitSleep = "abuse_limit"
+)
+
+// observeSleep counts a sleep caused by the GitHub limits.
+func observeSleep(reason string, d time.Duration) {
+	limitSleeps.WithLabelValues(reason).Inc()
+	limitSleepSeconds.WithLabelValues(reason).Add(d.Seconds())
+}
+
+type metricsTransport struct {
+	transport http.RoundTripper
+	apiPath   string
+}
+
+// NewMetricsTransport records the requests made through rt by endpoint and
+// status code. It must be used below the HTTP cache, so only the requests
+// actually sent to GitHub are counted. baseURL is the base URL of the REST
+// API, its path is not part of the endpoints.
+func NewMetricsTransport(rt http.RoundTripper, baseURL string) *metricsTransport {
+	return &metricsTransport{transport: rt, apiPath: apiPath(baseURL)}
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := endpointLabel(t.apiPath, req.URL.Path)
+
+	start := time.Now()
+	resp, err := t.transport.RoundTrip(req)
+	githubRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+
+	githubRequests.WithLabelValues(endpoint, code).Inc()
+	return resp, err
+}
+
+type cacheMetricsTransport struct {
+	transport http.RoundTripper
+}
+
+// NewCacheMetricsTransport counts the cache hits and misses of rt, that must
+// be an httpcache.Transport with MarkCachedResponses enabled.
+func NewCacheMetricsTransport(rt http.RoundTripper) *cacheMetricsTransport {
+	return &cacheMetricsTransport{transport: rt}
+}
+
+func (t *cacheMetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	// responses revalidated with a 304 are also marked as cached
+	result := "miss"
+	if resp.Header.Get("X-From-Cache") == "1" {
+		result = "hit"
+	}
+
+	cacheRequests.WithLabelValues(result).Inc()
+	return resp, nil
+}
+
+var numericSegment = regexp.MustCompile(`^[0-9]+$`)
+
+// apiPath returns the path of the base URL of the REST API without the
+// trailing slash, e.g. /api/v3 for GitHub Enterprise Server, or /github/api/v3
+// if it's served under a path prefix. It's empty for github.com.
+func apiPath(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// endpointLabel normalizes the path of a GitHub API request, replacing the
+// owners, names and ids with placeholders to keep the cardinality low, e.g.
+// /repos/src-d/ghsync/issues/1 is /repos/:owner/:repo/issues/:id. The path of
+// the REST API base URL, apiPath, is removed, and its parent for the GraphQL
+// endpoint, that is next to it.
+func endpointLabel(apiPath, path string) string {
+	if apiPath != "" {
+		root := pathpkg.Dir(apiPath)
+		switch {
+		case hasPathPrefix(path, apiPath):
+			path = strings.TrimPrefix(path, apiPath)
+		case root != "/" && hasPathPrefix(path, root):
+			path = strings.TrimPrefix(path, root)
+		}
+	}
+
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i := 0; i < len(segments); i++ {
+		switch {
+		case segments[i] == "repos" && i+1 < len(segments):
+			segments[i+1] = ":owner"
+			if i+2 < len(segments) {
+				segments[i+2] = ":repo"
+			}
+			i += 2
+		case (segments[i] == "orgs" || segments[i] == "users") && i+1 < len(segments):
+			segments[i+1] = ":login"
+			i++
+		case numericSegment.MatchString(segments[i]):
+			segments[i] = ":id"
+		}
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
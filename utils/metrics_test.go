@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"/", "/"},
+		{"/graphql", "/graphql"},
+		{"/rate_limit", "/rate_limit"},
+		{"/orgs/src-d", "/orgs/:login"},
+		{"/orgs/src-d/repos", "/orgs/:login/repos"},
+		{"/users/mcuadros", "/users/:login"},
+		{"/repos/src-d/ghsync", "/repos/:owner/:repo"},
+		{"/repos/src-d/ghsync/issues/12/comments", "/repos/:owner/:repo/issues/:id/comments"},
+		{"/repos/src-d/ghsync/pulls/comments/1234", "/repos/:owner/:repo/pulls/comments/:id"},
+		{"/repos/1234/1234/issues", "/repos/:owner/:repo/issues"},
+		{"/repositories/1234", "/repositories/:id"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(c.expected, endpointLabel("", c.path), c.path)
+	}
+}
+
+func TestEndpointLabelEnterprise(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		baseURL  string
+		path     string
+		expected string
+	}{
+		{"https://ghe.example.com/api/v3/", "/api/v3/repos/src-d/ghsync/pulls", "/repos/:owner/:repo/pulls"},
+		{"https://ghe.example.com/api/v3/", "/api/graphql", "/graphql"},
+		{"https://example.com/github/api/v3/", "/github/api/v3/repos/src-d/ghsync/pulls", "/repos/:owner/:repo/pulls"},
+		{"https://example.com/github/api/v3/", "/github/api/v3/orgs/src-d/repos", "/orgs/:login/repos"},
+		{"https://example.com/github/api/v3/", "/github/api/graphql", "/graphql"},
+		{"https://api.github.com/", "/repos/src-d/ghsync", "/repos/:owner/:repo"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(c.expected, endpointLabel(apiPath(c.baseURL), c.path), c.path)
+	}
+}
+
+func TestMaskToken(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", MaskToken(""))
+	assert.Equal("***", MaskToken("abc"))
+	assert.Equal("********wxyz", MaskToken("0123456789abcdefwxyz"))
+}
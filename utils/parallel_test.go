@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunParallel(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		m          sync.Mutex
+		running    int
+		maxRunning int
+		done       = make([]bool, 10)
+	)
+
+	err := RunParallel(context.Background(), 3, len(done), func(ctx context.Context, i int) error {
+		m.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		m.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		m.Lock()
+		running--
+		done[i] = true
+		m.Unlock()
+		return nil
+	})
+
+	assert.NoError(err)
+	assert.Equal(3, maxRunning)
+	for i, d := range done {
+		assert.True(d, "item %d", i)
+	}
+}
+
+func TestRunParallelError(t *testing.T) {
+	assert := assert.New(t)
+
+	errFoo := errors.New("foo")
+	var (
+		m       sync.Mutex
+		started int
+	)
+
+	err := RunParallel(context.Background(), 2, 100, func(ctx context.Context, i int) error {
+		m.Lock()
+		started++
+		m.Unlock()
+
+		if i == 0 {
+			return errFoo
+		}
+
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	assert.Equal(errFoo, err)
+	assert.True(started < 100)
+}
+
+func TestRunParallelCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := RunParallel(ctx, 2, 10, func(ctx context.Context, i int) error {
+		return nil
+	})
+
+	assert.Equal(context.Canceled, err)
+}
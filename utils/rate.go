@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,12 +24,21 @@ const (
 // rateLimitTransport implements GitHub's best practices
 // for avoiding rate limits
 // https://developer.github.com/v3/guides/best-practices-for-integrators/#dealing-with-abuse-rate-limits
+//
+// The read requests are sent concurrently, so several goroutines can use the
+// rate limit budget. The write requests are sent serially, and while a
+// request is sleeping because of the limits every other request waits too.
 type rateLimitTransport struct {
-	transport        http.RoundTripper
-	delayNextRequest bool
-	responseBody     []byte
+	transport http.RoundTripper
+
+	// writes serializes the write requests, lastWrite is when the last one
+	// was sent
+	writes    sync.Mutex
+	lastWrite time.Time
 
 	m sync.Mutex
+	// resume is when the limit sleep in progress ends
+	resume time.Time
 }
 
 func NewRateLimitTransport(rt http.RoundTripper) *rateLimitTransport {
@@ -35,23 +46,33 @@ func NewRateLimitTransport(rt http.RoundTripper) *rateLimitTransport {
 }
 
 func (rlt *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Make requests for a single user or client ID serially
-	// This is also necessary for safely saving
-	// and restoring bodies between retries below
-	rlt.lock(req)
-
-	// If you're making a large number of POST, PATCH, PUT, or DELETE requests
-	// for a single user or client ID, wait at least one second between each request.
-	if rlt.delayNextRequest {
-		log.Printf("[DEBUG] Sleeping %s between write operations", writeDelay)
-		time.Sleep(writeDelay)
+	if err := rlt.wait(req); err != nil {
+		return nil, err
 	}
 
-	rlt.delayNextRequest = isWriteMethod(req.Method)
+	if isWriteRequest(req) {
+		// If you're making a large number of POST, PATCH, PUT, or DELETE
+		// requests for a single user or client ID, make them serially and
+		// wait at least one second between each request.
+		rlt.writes.Lock()
+		defer rlt.writes.Unlock()
+
+		if d := writeDelay - time.Since(rlt.lastWrite); d > 0 {
+			log.Printf("[DEBUG] Sleeping %s between write operations", d)
+			if err := sleep(req.Context(), d); err != nil {
+				return nil, err
+			}
+		}
+
+		defer func() { rlt.lastWrite = time.Now() }()
+	}
 
+	return rlt.roundTrip(req)
+}
+
+func (rlt *rateLimitTransport) roundTrip(req *http.Request) (*http.Response, error) {
 	resp, err := rlt.transport.RoundTrip(req)
 	if err != nil {
-		rlt.unlock(req)
 		return resp, err
 	}
 
@@ -68,18 +89,22 @@ func (rlt *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, err
 
 	// When you have been limited, use the Retry-After response header to slow down.
 	if arlErr, ok := ghErr.(*github.AbuseRateLimitError); ok {
-		rlt.delayNextRequest = false
 		retryAfter := arlErr.GetRetryAfter()
 		log.Printf("[DEBUG] Abuse detection mechanism triggered, sleeping for %s before retrying",
 			retryAfter)
-		time.Sleep(retryAfter)
-		rlt.unlock(req)
-		return rlt.RoundTrip(req)
+		rlt.hold(retryAfter)
+		if err := sleepLimit(req, abuseLimitSleep, retryAfter); err != nil {
+			return nil, err
+		}
+
+		if err := RewindBody(req); err != nil {
+			return nil, err
+		}
+
+		return rlt.roundTrip(req)
 	}
 
 	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
-		rlt.delayNextRequest = false
-
 		var limit int
 		if limitHeader := resp.Header.Get("X-RateLimit-Limit"); limitHeader != "" {
 			limit, _ = strconv.Atoi(limitHeader)
@@ -100,23 +125,100 @@ func (rlt *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, err
 			log.Printf("[WARN] retryAfter < 0. reset: %v | now: %v",
 				reset, time.Now())
 		} else {
-			time.Sleep(retryAfter)
+			rlt.hold(retryAfter)
+			if err := sleepLimit(req, rateLimitSleep, retryAfter); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := RewindBody(req); err != nil {
+			return nil, err
 		}
 
-		rlt.unlock(req)
-		return rlt.RoundTrip(req)
+		return rlt.roundTrip(req)
 	}
 
-	rlt.unlock(req)
 	return resp, nil
 }
 
-func (rlt *rateLimitTransport) lock(req *http.Request) {
+// wait blocks the request until the limit sleep in progress, if any, ends.
+func (rlt *rateLimitTransport) wait(req *http.Request) error {
 	rlt.m.Lock()
+	d := time.Until(rlt.resume)
+	rlt.m.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+
+	return sleep(req.Context(), d)
 }
 
-func (rlt *rateLimitTransport) unlock(req *http.Request) {
-	rlt.m.Unlock()
+// hold makes the requests sent in the next d wait for it to pass.
+func (rlt *rateLimitTransport) hold(d time.Duration) {
+	rlt.m.Lock()
+	defer rlt.m.Unlock()
+
+	if resume := time.Now().Add(d); resume.After(rlt.resume) {
+		rlt.resume = resume
+	}
+}
+
+// LimitSleep is a sleep in progress caused by the GitHub limits.
+type LimitSleep struct {
+	// Reason is rate_limit or abuse_limit
+	Reason string    `json:"reason"`
+	Until  time.Time `json:"until"`
+}
+
+var currentSleeps struct {
+	sync.Mutex
+	next   int
+	sleeps map[int]LimitSleep
+}
+
+// sleepLimit sleeps for d because of the GitHub limits. The sleep is
+// recorded in the metrics and the span of the request, and reported by
+// CurrentLimitSleeps while it lasts. It's interrupted if the context of the
+// request is done, returning its error.
+func sleepLimit(req *http.Request, reason string, d time.Duration) error {
+	observeSleep(reason, d)
+	addSleepEvent(req, reason, d)
+
+	currentSleeps.Lock()
+	id := currentSleeps.next
+	currentSleeps.next++
+	if currentSleeps.sleeps == nil {
+		currentSleeps.sleeps = make(map[int]LimitSleep)
+	}
+	currentSleeps.sleeps[id] = LimitSleep{Reason: reason, Until: time.Now().Add(d)}
+	currentSleeps.Unlock()
+
+	err := sleep(req.Context(), d)
+
+	currentSleeps.Lock()
+	delete(currentSleeps.sleeps, id)
+	currentSleeps.Unlock()
+
+	return err
+}
+
+// CurrentLimitSleeps returns the sleeps caused by the GitHub limits that are
+// in progress, so a process waiting for them isn't mistaken for a hung one.
+func CurrentLimitSleeps() []LimitSleep {
+	currentSleeps.Lock()
+	defer currentSleeps.Unlock()
+
+	var sleeps []LimitSleep
+	for _, s := range currentSleeps.sleeps {
+		sleeps = append(sleeps, s)
+	}
+
+	sort.Slice(sleeps, func(i, j int) bool {
+		return sleeps[i].Until.Before(sleeps[j].Until)
+	})
+
+	return sleeps
 }
 
 // drainBody reads all of b to memory and then returns two equivalent
@@ -136,8 +238,13 @@ func drainBody(b io.ReadCloser) (r1, r2 io.ReadCloser, err error) {
 	return ioutil.NopCloser(&buf), ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
 }
 
-func isWriteMethod(method string) bool {
-	switch method {
+func isWriteRequest(req *http.Request) bool {
+	// GraphQL queries are sent as POST requests, but they only read data
+	if strings.HasSuffix(req.URL.Path, "/graphql") {
+		return false
+	}
+
+	switch req.Method {
 	case "POST", "PATCH", "PUT", "DELETE":
 		return true
 	}
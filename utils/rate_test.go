@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -60,6 +62,54 @@ func TestAbuseLimit(t *testing.T) {
 	assert.True(spent >= time.Second)
 }
 
+func TestCurrentLimitSleeps(t *testing.T) {
+	assert := assert.New(t)
+
+	mt := &abuseTransport{
+		RetryAfter: 1,
+	}
+	c := newClient(assert, mt)
+
+	done := make(chan struct{})
+	go func() {
+		c.getSuccess()
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	sleeps := CurrentLimitSleeps()
+	if assert.Len(sleeps, 1) {
+		assert.Equal(abuseLimitSleep, sleeps[0].Reason)
+		assert.True(sleeps[0].Until.After(time.Now()))
+	}
+
+	<-done
+	assert.Empty(CurrentLimitSleeps())
+}
+
+func TestRateLimitCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	mt := &rateTransport{
+		Limit: 1,
+		Reset: time.Now().Add(time.Hour),
+	}
+	c := newClient(assert, mt)
+	c.getSuccess()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// the sleep until the reset is interrupted
+	spent := measure(func() {
+		_, _, err := c.Users.Get(ctx, "")
+		assert.Equal(context.DeadlineExceeded, err)
+	})
+	assert.True(spent < time.Second)
+	assert.Empty(CurrentLimitSleeps())
+}
+
 func TestWriteLimit(t *testing.T) {
 	assert := assert.New(t)
 
@@ -84,6 +134,48 @@ func TestWriteLimit(t *testing.T) {
 	assert.True(spent > time.Second)
 }
 
+func TestConcurrentReads(t *testing.T) {
+	assert := assert.New(t)
+
+	mt := &slowTransport{Delay: 200 * time.Millisecond}
+	c := newClient(assert, mt)
+
+	// the read requests are not serialized
+	spent := measure(func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.getSuccess()
+			}()
+		}
+
+		wg.Wait()
+	})
+	assert.True(spent < 400*time.Millisecond)
+}
+
+func TestRateLimitRetryBody(t *testing.T) {
+	assert := assert.New(t)
+
+	mt := &bodyTransport{T: &rateTransport{
+		Limit: 0,
+		Reset: time.Now().Add(time.Second),
+	}}
+	rt := NewRateLimitTransport(mt)
+
+	query := `{"query":"{ viewer { login } }"}`
+	req, err := http.NewRequest("POST", "https://api.github.com/graphql", strings.NewReader(query))
+	assert.NoError(err)
+
+	// the query is sent again with its body after the limit sleep
+	resp, err := rt.RoundTrip(req)
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal([]string{query, query}, mt.bodies)
+}
+
 // helper to mesure time
 func measure(fn func()) time.Duration {
 	start := time.Now()
@@ -185,6 +277,40 @@ func (t *abuseTransport) RoundTrip(*http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
+// emulates successful responses that take a while
+type slowTransport struct {
+	Delay time.Duration
+}
+
+func (t *slowTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	time.Sleep(t.Delay)
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+	}
+	resp.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return resp, nil
+}
+
+// records the body of the requests
+type bodyTransport struct {
+	T http.RoundTripper
+
+	bodies []string
+}
+
+func (t *bodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	t.bodies = append(t.bodies, string(b))
+	return t.T.RoundTrip(req)
+}
+
 // github library relies on particular error payload from github, not only status
 type errorPayload struct {
 	Message string `json:"message"`
@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"context"
+	"fmt"
+	"net/http"
 	"time"
 
 	"gopkg.in/src-d/go-log.v1"
@@ -12,7 +15,9 @@ const (
 	truncate = 10 * time.Second
 )
 
-func Retry(f func() error) error {
+// Retry calls f until it succeeds, sleeping between the attempts. It stops
+// when ctx is done.
+func Retry(ctx context.Context, f func() error) error {
 	d := delay
 	var i uint
 
@@ -22,12 +27,14 @@ func Retry(f func() error) error {
 			return nil
 		}
 
-		if i == retries {
+		if i == retries || ctx.Err() != nil {
 			return err
 		}
 
 		log.Errorf(err, "retrying in %v", d)
-		time.Sleep(d)
+		if err := sleep(ctx, d); err != nil {
+			return err
+		}
 
 		d = d * (1<<i + 1)
 		if d > truncate {
@@ -35,3 +42,37 @@ func Retry(f func() error) error {
 		}
 	}
 }
+
+// RewindBody resets the body of a request that is going to be sent again,
+// since the previous attempt already read it. GraphQL queries, for example,
+// are POST requests.
+func RewindBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+
+	if req.GetBody == nil {
+		return fmt.Errorf("can't retry %s %s, its body can't be rewound", req.Method, req.URL)
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+
+	req.Body = body
+	return nil
+}
+
+// sleep pauses for d, it returns the error of ctx if it's done before.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
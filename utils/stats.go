@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Outcome is the result of syncing a single resource.
+type Outcome int
+
+const (
+	Inserted Outcome = iota
+	Updated
+	Skipped
+	Failed
+)
+
+// EntityStats are the number of resources of an entity by outcome.
+type EntityStats struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+// Stats collects the outcome of the resources synced and the GitHub API
+// calls made during a run. It's safe for concurrent use, and all its methods
+// can be called on a nil Stats, that ignores everything.
+type Stats struct {
+	apiCalls int64
+	// lastProgress is the unix time in nanoseconds of the last resource
+	// recorded or API call answered
+	lastProgress int64
+
+	m        sync.Mutex
+	entities map[Entity]*EntityStats
+	synced   []string
+}
+
+func NewStats() *Stats {
+	return &Stats{entities: make(map[Entity]*EntityStats)}
+}
+
+// Record adds a resource of the entity to the stats. The outcome is ignored
+// and the resource counted as failed if err is not nil.
+func (s *Stats) Record(e Entity, o Outcome, err error) {
+	s.RecordN(e, o, 1, err)
+}
+
+// RecordN adds n resources of the entity with the same outcome, such as the
+// ones written together in a batch.
+func (s *Stats) RecordN(e Entity, o Outcome, n int, err error) {
+	if s == nil || n == 0 {
+		return
+	}
+
+	if err != nil {
+		o = Failed
+	}
+
+	s.progressed()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	es, ok := s.entities[e]
+	if !ok {
+		es = &EntityStats{}
+		s.entities[e] = es
+	}
+
+	switch o {
+	case Inserted:
+		es.Inserted += n
+	case Updated:
+		es.Updated += n
+	case Skipped:
+		es.Skipped += n
+	case Failed:
+		es.Failed += n
+	}
+}
+
+// RepositorySynced records that a repository was successfully synced.
+func (s *Stats) RepositorySynced(owner, name string) {
+	if s == nil {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.synced = append(s.synced, owner+"/"+name)
+}
+
+// TakeSyncedRepositories returns the full names of the repositories synced
+// since the last call.
+func (s *Stats) TakeSyncedRepositories() []string {
+	if s == nil {
+		return nil
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	synced := s.synced
+	s.synced = nil
+	return synced
+}
+
+// Entities returns a copy of the stats of every entity.
+func (s *Stats) Entities() map[Entity]EntityStats {
+	result := make(map[Entity]EntityStats)
+	if s == nil {
+		return result
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for e, es := range s.entities {
+		result[e] = *es
+	}
+
+	return result
+}
+
+// APICalls returns the number of GitHub API calls that consumed rate limit.
+func (s *Stats) APICalls() int64 {
+	if s == nil {
+		return 0
+	}
+
+	return atomic.LoadInt64(&s.apiCalls)
+}
+
+// LastProgress returns when the last resource was recorded or API call
+// answered, it's zero if there was none.
+func (s *Stats) LastProgress() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+
+	last := atomic.LoadInt64(&s.lastProgress)
+	if last == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, last)
+}
+
+func (s *Stats) progressed() {
+	atomic.StoreInt64(&s.lastProgress, time.Now().UnixNano())
+}
+
+type statsTransport struct {
+	transport http.RoundTripper
+	stats     *Stats
+}
+
+// NewStatsTransport counts in stats the requests made through rt. Responses
+// with 304 Not Modified are not counted, as they don't consume rate limit.
+func NewStatsTransport(rt http.RoundTripper, stats *Stats) *statsTransport {
+	return &statsTransport{transport: rt, stats: stats}
+}
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err == nil && t.stats != nil {
+		t.stats.progressed()
+		if resp.StatusCode != http.StatusNotModified {
+			atomic.AddInt64(&t.stats.apiCalls, 1)
+		}
+	}
+
+	return resp, err
+}
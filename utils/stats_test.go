@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsRecord(t *testing.T) {
+	assert := assert.New(t)
+
+	s := NewStats()
+	assert.True(s.LastProgress().IsZero())
+
+	s.Record(IssueEntity, Inserted, nil)
+	s.Record(IssueEntity, Inserted, nil)
+	s.Record(IssueEntity, Updated, errors.New("foo"))
+	s.Record(UserEntity, Skipped, nil)
+	s.RecordN(CommentEntity, Updated, 3, nil)
+	s.RecordN(CommentEntity, Inserted, 2, errors.New("foo"))
+
+	assert.Equal(map[Entity]EntityStats{
+		IssueEntity:   {Inserted: 2, Failed: 1},
+		UserEntity:    {Skipped: 1},
+		CommentEntity: {Updated: 3, Failed: 2},
+	}, s.Entities())
+	assert.False(s.LastProgress().IsZero())
+
+	s.RepositorySynced("src-d", "ghsync")
+	assert.Equal([]string{"src-d/ghsync"}, s.TakeSyncedRepositories())
+	assert.Len(s.TakeSyncedRepositories(), 0)
+
+	var nilStats *Stats
+	nilStats.Record(IssueEntity, Inserted, nil)
+	assert.Len(nilStats.Entities(), 0)
+	assert.True(nilStats.LastProgress().IsZero())
+}
+
+func TestStatsTransport(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	defer ts.Close()
+
+	s := NewStats()
+	client := &http.Client{Transport: NewStatsTransport(http.DefaultTransport, s)}
+
+	_, err := client.Get(ts.URL)
+	assert.NoError(err)
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	assert.NoError(err)
+	req.Header.Set("If-None-Match", "etag")
+	_, err = client.Do(req)
+	assert.NoError(err)
+
+	assert.Equal(int64(1), s.APICalls())
+}
@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenPoolTransport rotates the requests between several personal access
+// tokens. Every request is routed to the token with the most remaining rate
+// limit budget, and the X-RateLimit-* headers of the responses are rewritten
+// with the aggregated budget of the pool, so a rateLimitTransport on top of
+// it only sleeps when all the tokens are exhausted.
+type tokenPoolTransport struct {
+	tokens []*poolToken
+
+	m sync.Mutex
+}
+
+type poolToken struct {
+	transport http.RoundTripper
+	// label identifies the token in the metrics without disclosing it
+	label string
+
+	// limit and remaining are -1 until the first response for the token
+	// is received
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// NewTokenPoolTransport returns a transport that authenticates the requests
+// sent to rt using the given tokens.
+func NewTokenPoolTransport(rt http.RoundTripper, tokens []string) *tokenPoolTransport {
+	t := &tokenPoolTransport{}
+	for _, token := range tokens {
+		t.tokens = append(t.tokens, &poolToken{
+			transport: &oauth2.Transport{
+				Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}),
+				Base:   rt,
+			},
+			label:     MaskToken(token),
+			limit:     -1,
+			remaining: -1,
+		})
+	}
+
+	return t
+}
+
+func (t *tokenPoolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for {
+		token := t.pick()
+
+		resp, err := token.transport.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+
+		t.update(token, resp.Header)
+
+		if isRateLimited(resp) && t.available() && canRewind(req) {
+			log.Printf("[DEBUG] Rate limit reached for one of the tokens, retrying with another one")
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+
+			if req.GetBody != nil {
+				if req.Body, err = req.GetBody(); err != nil {
+					return nil, err
+				}
+			}
+
+			continue
+		}
+
+		t.aggregate(resp.Header)
+		return resp, nil
+	}
+}
+
+// pick returns the token with the most remaining budget.
+func (t *tokenPoolTransport) pick() *poolToken {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	now := time.Now()
+
+	var best *poolToken
+	for _, token := range t.tokens {
+		if best == nil || token.budget(now) > best.budget(now) {
+			best = token
+		}
+	}
+
+	return best
+}
+
+func (t *tokenPoolTransport) update(token *poolToken, h http.Header) {
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	token.remaining = remaining
+	if limit, err := strconv.Atoi(h.Get("X-RateLimit-Limit")); err == nil {
+		token.limit = limit
+	}
+
+	if v, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		token.reset = time.Unix(v, 0)
+		rateLimitReset.WithLabelValues(token.label).Set(float64(v))
+	}
+
+	rateLimitRemaining.WithLabelValues(token.label).Set(float64(remaining))
+}
+
+// available returns true if any of the tokens has some budget left.
+func (t *tokenPoolTransport) available() bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	now := time.Now()
+	for _, token := range t.tokens {
+		if token.budget(now) != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// aggregate replaces the rate limit headers of a response with the sum of
+// the budgets of all the tokens. The reset time is the earliest one, which
+// is when the first exhausted token will be usable again.
+func (t *tokenPoolTransport) aggregate(h http.Header) {
+	if h.Get("X-RateLimit-Remaining") == "" {
+		return
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	now := time.Now()
+
+	var limit, remaining int
+	var reset time.Time
+	for _, token := range t.tokens {
+		if token.remaining < 0 {
+			// tokens not used yet are expected to have the same limit as
+			// the one that has just answered
+			l, _ := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+			limit += l
+			remaining += l
+			continue
+		}
+
+		limit += token.limit
+		remaining += token.budget(now)
+		if token.budget(now) == 0 && (reset.IsZero() || token.reset.Before(reset)) {
+			reset = token.reset
+		}
+	}
+
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if !reset.IsZero() {
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	}
+}
+
+// budget returns the remaining requests of the token. Tokens not used yet
+// are preferred over any other one.
+func (t *poolToken) budget(now time.Time) int {
+	if t.remaining < 0 {
+		return math.MaxInt32
+	}
+
+	if !t.reset.IsZero() && now.After(t.reset) {
+		return t.limit
+	}
+
+	return t.remaining
+}
+
+func isRateLimited(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusForbidden &&
+		resp.Header.Get("X-RateLimit-Remaining") == "0"
+}
+
+func canRewind(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// MaskToken hides all but the last characters of a token.
+func MaskToken(token string) string {
+	if len(token) <= 4 {
+		return strings.Repeat("*", len(token))
+	}
+
+	return strings.Repeat("*", 8) + token[len(token)-4:]
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenPoolRotation(t *testing.T) {
+	assert := assert.New(t)
+
+	mt := &tokenRateTransport{
+		Limit: 2,
+		Reset: time.Now().Add(2 * time.Second),
+	}
+	c := newClient(assert, NewTokenPoolTransport(mt, []string{"foo", "bar"}))
+
+	// the budget of both tokens must be consumed without sleeping
+	spent := measure(func() {
+		c.getSuccess()
+		c.getSuccess()
+		c.getSuccess()
+		c.getSuccess()
+	})
+	assert.True(spent < time.Second)
+	assert.Equal(2, mt.requests["Bearer foo"])
+	assert.Equal(2, mt.requests["Bearer bar"])
+
+	// all the tokens are exhausted, so it should sleep until the reset
+	spent = measure(func() {
+		c.getSuccess()
+	})
+	assert.True(spent > time.Second)
+}
+
+func TestTokenPoolSingleToken(t *testing.T) {
+	assert := assert.New(t)
+
+	mt := &tokenRateTransport{
+		Limit: 2,
+		Reset: time.Now().Add(2 * time.Second),
+	}
+	c := newClient(assert, NewTokenPoolTransport(mt, []string{"foo"}))
+
+	spent := measure(func() {
+		c.getSuccess()
+		c.getSuccess()
+	})
+	assert.True(spent < time.Second)
+
+	spent = measure(func() {
+		c.getSuccess()
+	})
+	assert.True(spent > time.Second)
+}
+
+// emulates responses with X-RateLimit header, keeping a separate budget
+// for each Authorization header
+type tokenRateTransport struct {
+	// number of requests to allow per token before hitting the limit
+	Limit int
+	// when to reset the remaining number
+	Reset time.Time
+
+	requests map[string]int
+}
+
+func (t *tokenRateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.requests == nil {
+		t.requests = make(map[string]int)
+	}
+
+	auth := req.Header.Get("Authorization")
+	if time.Now().After(t.Reset) {
+		t.requests[auth] = 0
+		t.Reset = time.Now().Add(time.Hour)
+	}
+
+	remaining := t.Limit - t.requests[auth]
+	var resp *http.Response
+	if remaining == 0 {
+		resp = &http.Response{
+			StatusCode: http.StatusForbidden,
+			Header:     make(http.Header),
+			Body:       ioutil.NopCloser(bytes.NewBuffer(limitPayload)),
+		}
+	} else {
+		t.requests[auth]++
+		resp = &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+		}
+	}
+
+	resp.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp.Header.Set("X-RateLimit-Limit", strconv.Itoa(t.Limit))
+	resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(t.Reset.Unix(), 10))
+	resp.Header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+
+	return resp, nil
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/src-d/go-kallax.v1"
+)
+
+// TracerName is the name of the tracer of the spans created by ghsync.
+const TracerName = "github.com/src-d/ghsync"
+
+// Tracer returns the tracer of the spans created by ghsync. It uses the
+// global TracerProvider, so nothing is recorded until one is set with
+// otel.SetTracerProvider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// EndSpan ends the span, marking it as failed if err is not nil.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// StartStoreOp traces an operation of a kallax store on the resources of the
+// entity, like find, insert, update or upsert. The returned function ends it,
+// the duration of the writes is also recorded in the metrics.
+func StartStoreOp(ctx context.Context, op string, e Entity) (end func(error)) {
+	start := time.Now()
+	_, span := Tracer().Start(ctx, fmt.Sprintf("kallax.%s %s", op, e),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", op),
+			attribute.String("ghsync.entity", string(e)),
+		),
+	)
+
+	return func(err error) {
+		// a missing resource is an expected result of find
+		if err == kallax.ErrNotFound {
+			err = nil
+		}
+
+		if op == "insert" || op == "update" || op == "upsert" {
+			dbWriteDuration.WithLabelValues(string(e)).Observe(time.Since(start).Seconds())
+		}
+
+		EndSpan(span, err)
+	}
+}
+
+type tracingTransport struct {
+	transport http.RoundTripper
+	apiPath   string
+}
+
+// NewTracingTransport creates a span for each request made through rt, as a
+// child of the span in the context of the request. It must be the outermost
+// transport, so the time spent in the cache, retries and rate limit sleeps
+// is part of the span. baseURL is the base URL of the REST API, as in
+// NewMetricsTransport.
+func NewTracingTransport(rt http.RoundTripper, baseURL string) *tracingTransport {
+	return &tracingTransport{transport: rt, apiPath: apiPath(baseURL)}
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Tracer().Start(req.Context(),
+		fmt.Sprintf("github %s %s", req.Method, endpointLabel(t.apiPath, req.URL.Path)),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.method", req.Method),
+			attribute.String("http.url", req.URL.String()),
+		),
+	)
+
+	resp, err := t.transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		EndSpan(span, err)
+		return resp, err
+	}
+
+	span.SetAttributes(
+		attribute.Int("http.status_code", resp.StatusCode),
+		attribute.Bool("ghsync.cache_hit", resp.Header.Get("X-From-Cache") == "1"),
+	)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+
+	span.End()
+	return resp, nil
+}
+
+// addSleepEvent records a sleep caused by the GitHub limits in the span of
+// the request, if any.
+func addSleepEvent(req *http.Request, reason string, d time.Duration) {
+	trace.SpanFromContext(req.Context()).AddEvent("sleep", trace.WithAttributes(
+		attribute.String("reason", reason),
+		attribute.String("duration", d.String()),
+	))
+}
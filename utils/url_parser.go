@@ -7,58 +7,116 @@ import (
 	"strings"
 )
 
-func ParsePullRequestURL(rawurl string) (owner, repo string, number int, err error) {
-	u, err := url.Parse(rawurl)
+const enterpriseAPIPrefix = "/api/v3"
+
+// URLParser parses the URLs of issues and pull requests of github.com and,
+// if it's given, of a GitHub Enterprise Server instance.
+type URLParser struct {
+	// host and path are the host and the path prefix of the GitHub
+	// Enterprise Server instance, empty if there isn't one
+	host string
+	path string
+}
+
+// NewURLParser returns a parser that accepts the URLs of github.com and of
+// the GitHub Enterprise Server instance at enterpriseURL, if it's not empty.
+// The instance can be served under a path prefix, e.g.
+// https://example.com/github/, with its API at /github/api/v3.
+func NewURLParser(enterpriseURL string) (*URLParser, error) {
+	p := &URLParser{}
+	if enterpriseURL == "" {
+		return p, nil
+	}
+
+	u, err := url.Parse(enterpriseURL)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	parts := strings.Split(u.RequestURI(), "/")
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid GitHub Enterprise URL: %s", enterpriseURL)
+	}
 
-	switch u.Host {
-	case "api.github.com":
-		// https://api.github.com/repos/octocat/Hello-World/pulls/1347
-		owner = parts[2]
-		repo = parts[3]
-		number, _ = strconv.Atoi(parts[5])
+	p.host = u.Host
+	// the API URL can be given instead of the web one
+	p.path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), enterpriseAPIPrefix)
+	return p, nil
+}
+
+func (p *URLParser) ParsePullRequestURL(rawurl string) (owner, repo string, number int, err error) {
+	// https://api.github.com/repos/octocat/Hello-World/pulls/1347
+	// https://github.com/src-d/go-kallax/pull/309
+	// https://github.example.com/api/v3/repos/octocat/Hello-World/pulls/1347
+	return p.parse(rawurl)
+}
 
-	case "github.com":
-		// https://github.com/src-d/go-kallax/pull/309
-		owner = parts[1]
-		repo = parts[2]
-		number, _ = strconv.Atoi(parts[4])
+func (p *URLParser) ParseIssueURL(rawurl string) (owner, repo string, number int, err error) {
+	// https://api.github.com/repos/octocat/Hello-World/issues/1347
+	// https://github.com/cncf/devstats-example/issues/2
+	// https://github.example.com/api/v3/repos/octocat/Hello-World/issues/1347
+	return p.parse(rawurl)
+}
 
+func (p *URLParser) parse(rawurl string) (owner, repo string, number int, err error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return
+	}
+
+	path := u.Path
+	switch {
+	case u.Host == "api.github.com":
+		path = strings.TrimPrefix(path, "/repos")
+	case u.Host == "github.com":
+	case p.host != "" && u.Host == p.host && hasPathPrefix(path, p.path):
+		path = strings.TrimPrefix(path, p.path)
+		if hasPathPrefix(path, enterpriseAPIPrefix) {
+			path = strings.TrimPrefix(path, enterpriseAPIPrefix+"/repos")
+		}
 	default:
 		err = fmt.Errorf("unsupported url: %s", rawurl)
+		return
 	}
 
-	return
+	return parseRepositoryPath(rawurl, path)
 }
 
-func ParseIssueURL(rawurl string) (owner, repo string, number int, err error) {
+// ParseAPIURL parses the REST API URL of an issue or pull request, like
+// https://api.github.com/repos/octocat/Hello-World/pulls/1347. These URLs
+// have the same path in github.com and in any GitHub Enterprise Server
+// instance, after its prefix, so the host doesn't need to be known.
+func ParseAPIURL(rawurl string) (owner, repo string, number int, err error) {
 	u, err := url.Parse(rawurl)
 	if err != nil {
 		return
 	}
 
-	parts := strings.Split(u.RequestURI(), "/")
-
-	switch u.Host {
-	case "api.github.com":
-		// "https://api.github.com/repos/octocat/Hello-World/issues/1347",
-		owner = parts[2]
-		repo = parts[3]
-		number, _ = strconv.Atoi(parts[5])
+	// .../repos/owner/repo/kind/number
+	parts := strings.Split(strings.TrimSuffix(u.Path, "/"), "/")
+	if len(parts) < 6 || parts[len(parts)-5] != "repos" {
+		err = fmt.Errorf("unsupported url: %s", rawurl)
+		return
+	}
 
-	case "github.com":
-		// https://github.com/cncf/devstats-example/issues/2
-		owner = parts[1]
-		repo = parts[2]
-		number, _ = strconv.Atoi(parts[4])
+	return parseRepositoryPath(rawurl, "/"+strings.Join(parts[len(parts)-4:], "/"))
+}
 
-	default:
+func parseRepositoryPath(rawurl, path string) (owner, repo string, number int, err error) {
+	// /owner/repo/kind/number
+	parts := strings.Split(path, "/")
+	if len(parts) < 5 {
 		err = fmt.Errorf("unsupported url: %s", rawurl)
+		return
 	}
 
+	owner = parts[1]
+	repo = parts[2]
+	number, _ = strconv.Atoi(parts[4])
+
 	return
 }
+
+// hasPathPrefix returns true if the path is prefix or one of its children.
+func hasPathPrefix(path, prefix string) bool {
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseURL(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := NewURLParser("https://github.example.com/")
+	assert.NoError(err)
+
+	cases := []struct {
+		url    string
+		parse  func(string) (string, string, int, error)
+		owner  string
+		repo   string
+		number int
+	}{
+		{"https://api.github.com/repos/octocat/Hello-World/pulls/1347", p.ParsePullRequestURL, "octocat", "Hello-World", 1347},
+		{"https://github.com/src-d/go-kallax/pull/309", p.ParsePullRequestURL, "src-d", "go-kallax", 309},
+		{"https://github.example.com/api/v3/repos/octocat/Hello-World/pulls/1347", p.ParsePullRequestURL, "octocat", "Hello-World", 1347},
+		{"https://github.example.com/src-d/go-kallax/pull/309", p.ParsePullRequestURL, "src-d", "go-kallax", 309},
+		{"https://api.github.com/repos/octocat/Hello-World/issues/1347", p.ParseIssueURL, "octocat", "Hello-World", 1347},
+		{"https://github.com/cncf/devstats-example/issues/2", p.ParseIssueURL, "cncf", "devstats-example", 2},
+		{"https://github.example.com/api/v3/repos/octocat/Hello-World/issues/1347", p.ParseIssueURL, "octocat", "Hello-World", 1347},
+		{"https://github.example.com/cncf/devstats-example/issues/2", p.ParseIssueURL, "cncf", "devstats-example", 2},
+	}
+
+	for _, c := range cases {
+		owner, repo, number, err := c.parse(c.url)
+		assert.NoError(err, c.url)
+		assert.Equal(c.owner, owner, c.url)
+		assert.Equal(c.repo, repo, c.url)
+		assert.Equal(c.number, number, c.url)
+	}
+}
+
+func TestParseURLPathPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, base := range []string{"https://example.com/github/", "https://example.com/github/api/v3/"} {
+		p, err := NewURLParser(base)
+		assert.NoError(err)
+
+		for _, url := range []string{
+			"https://example.com/github/api/v3/repos/octocat/Hello-World/pulls/1347",
+			"https://example.com/github/octocat/Hello-World/pull/1347",
+		} {
+			owner, repo, number, err := p.ParsePullRequestURL(url)
+			assert.NoError(err, url)
+			assert.Equal("octocat", owner, url)
+			assert.Equal("Hello-World", repo, url)
+			assert.Equal(1347, number, url)
+		}
+
+		_, _, _, err = p.ParsePullRequestURL("https://example.com/octocat/Hello-World/pull/1347")
+		assert.Error(err)
+	}
+}
+
+func TestParseURLUnsupported(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := NewURLParser("")
+	assert.NoError(err)
+
+	_, _, _, err = p.ParseIssueURL("https://gitlab.com/foo/bar/issues/1")
+	assert.Error(err)
+
+	_, _, _, err = p.ParsePullRequestURL("https://github.com/foo")
+	assert.Error(err)
+
+	_, _, _, err = p.ParseIssueURL("https://github.example.com/foo/bar/issues/1")
+	assert.Error(err)
+
+	_, err = NewURLParser("github.example.com")
+	assert.Error(err)
+}
+
+func TestParseAPIURL(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, url := range []string{
+		"https://api.github.com/repos/octocat/Hello-World/issues/1347",
+		"https://github.example.com/api/v3/repos/octocat/Hello-World/pulls/1347",
+		"https://example.com/github/api/v3/repos/octocat/Hello-World/issues/1347",
+	} {
+		owner, repo, number, err := ParseAPIURL(url)
+		assert.NoError(err, url)
+		assert.Equal("octocat", owner, url)
+		assert.Equal("Hello-World", repo, url)
+		assert.Equal(1347, number, url)
+	}
+
+	_, _, _, err := ParseAPIURL("https://github.com/octocat/Hello-World/pull/1347")
+	assert.Error(err)
+}